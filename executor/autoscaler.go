@@ -0,0 +1,170 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"sync"
+	"time"
+)
+
+// Autoscaling configuration parameters. Like Java ThreadPoolExecutor, executor
+// counts of ExecPoolCfg are the core counts; the pool grows up to the maximum
+// counts when work queues up and executors above the core count are retired
+// once they stay idle for the keep alive duration.
+type AutoscalingCfg struct {
+	Enabled bool `json:"enabled"`
+
+	// Upper limits on the number of executors, at least the core counts.
+	MaxAsyncTaskExecutorCount    int `json:"max_async_task_executor_count"`
+	MaxBlockingTaskExecutorCount int `json:"max_blocking_task_executor_count"`
+
+	// Average number of queued tasks per executor at or above which one more
+	// executor is added.
+	ScaleUpQueueDepth int `json:"scale_up_queue_depth"`
+
+	// How long, in milliseconds, an executor above the core count can remain
+	// idle before it is retired.
+	KeepAliveMs int `json:"keep_alive_ms"`
+
+	// How often, in milliseconds, the pool is evaluated.
+	CheckIntervalMs int `json:"check_interval_ms"`
+}
+
+// Default evaluation interval if none is configured.
+const defaultAutoscaleInterval = 100 * time.Millisecond
+
+// Periodically evaluates queue depth and idle executors of a pool, adding or
+// retiring one executor per kind at a time.
+type autoscaler struct {
+	mux          sync.Mutex
+	pool         *ExecutorPool
+	cfg          AutoscalingCfg
+	coreAsync    int
+	coreBlocking int
+	interval     time.Duration
+	keepAlive    time.Duration
+	quit         chan struct{}
+	running      bool
+}
+
+func newAutoscaler(pool *ExecutorPool, cfg AutoscalingCfg) *autoscaler {
+	as := new(autoscaler)
+	as.pool = pool
+	as.cfg = cfg
+	as.coreAsync = pool.poolCfg.AsyncTaskExecutorCount
+	as.coreBlocking = pool.poolCfg.BlockingTaskExecutorCount
+	as.interval = time.Duration(cfg.CheckIntervalMs) * time.Millisecond
+	if as.interval <= 0 {
+		as.interval = defaultAutoscaleInterval
+	}
+	as.keepAlive = time.Duration(cfg.KeepAliveMs) * time.Millisecond
+	if as.cfg.ScaleUpQueueDepth < 1 {
+		as.cfg.ScaleUpQueueDepth = 1
+	}
+	as.setCore(as.coreAsync, as.coreBlocking)
+	return as
+}
+
+// Core counts changed, maximum counts are raised if needed.
+func (as *autoscaler) setCore(async int, blocking int) {
+	as.mux.Lock()
+	defer as.mux.Unlock()
+	as.coreAsync = async
+	as.coreBlocking = blocking
+	if as.cfg.MaxAsyncTaskExecutorCount < async {
+		as.cfg.MaxAsyncTaskExecutorCount = async
+	}
+	if as.cfg.MaxBlockingTaskExecutorCount < blocking {
+		as.cfg.MaxBlockingTaskExecutorCount = blocking
+	}
+}
+
+func (as *autoscaler) start() {
+	as.mux.Lock()
+	defer as.mux.Unlock()
+	if as.running {
+		return
+	}
+	as.running = true
+	as.quit = make(chan struct{})
+	go as.run(as.quit)
+}
+
+func (as *autoscaler) stop() {
+	as.mux.Lock()
+	defer as.mux.Unlock()
+	if as.running {
+		as.running = false
+		close(as.quit)
+	}
+}
+
+func (as *autoscaler) run(quit chan struct{}) {
+	ticker := time.NewTicker(as.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			as.evaluate()
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (as *autoscaler) evaluate() {
+	as.mux.Lock()
+	coreAsync, coreBlocking := as.coreAsync, as.coreBlocking
+	maxAsync, maxBlocking := as.cfg.MaxAsyncTaskExecutorCount, as.cfg.MaxBlockingTaskExecutorCount
+	as.mux.Unlock()
+
+	p := as.pool
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if !p.lc.isRunning() {
+		return
+	}
+	// We shrink only when there are fewer tasks in flight than executors, so
+	// that we are not retiring executors which would be needed right away.
+	slack := true
+	if p.stats != nil {
+		p.stats.Lock()
+		slack = p.stats.TasksInExecution < len(p.asyncExecutors)+len(p.blockingExecutors)
+		p.stats.Unlock()
+	}
+	p.asyncExecutors = as.scale(p.asyncExecutors, coreAsync, maxAsync, slack, p.asyncGroup)
+	p.blockingExecutors = as.scale(p.blockingExecutors, coreBlocking, maxBlocking, slack, p.blockingGroup)
+}
+
+// Caller holds the pool lock.
+func (as *autoscaler) scale(executors []Executor, core int, max int, slack bool, g *executorGroup) []Executor {
+	queued := 0
+	for _, e := range executors {
+		queued += e.HowManyInQueue()
+	}
+	if len(executors) < max && queued >= as.cfg.ScaleUpQueueDepth*len(executors) {
+		e := as.pool.newMember(g)
+		e.Start()
+		util.LogDebug(fmt.Sprintf("Autoscaler added an executor, %d queued tasks on %d executors",
+			queued, len(executors)))
+		return append(executors, e)
+	}
+	if len(executors) > core && slack {
+		for i := len(executors) - 1; i >= 0; i-- {
+			if t, ok := executors[i].(*thread); ok && t.idleFor() >= as.keepAlive {
+				remaining := make([]Executor, 0, len(executors)-1)
+				remaining = append(remaining, executors[:i]...)
+				remaining = append(remaining, executors[i+1:]...)
+				util.LogDebug(fmt.Sprintf("Autoscaler retired an executor idle for %v", t.idleFor()))
+				// a task may still reach it after the idle check, so the pool
+				// keeps track of it till it terminates
+				as.pool.retireExecutor(t)
+				return remaining
+			}
+		}
+	}
+	return executors
+}
@@ -0,0 +1,133 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of wall clock time for components which run tasks at
+// given times. SystemClock is used in production, ManualClock lets tests
+// move the time forward deterministically without sleeping.
+type Clock interface {
+	Now() time.Time
+
+	NewTimer(d time.Duration) ClockTimer
+}
+
+// Timer created by a Clock. Like time.Timer, the channel receives the time
+// once the timer expires.
+type ClockTimer interface {
+	C() <-chan time.Time
+
+	Stop() bool
+}
+
+// Clock backed by the time package.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) NewTimer(d time.Duration) ClockTimer {
+	return &systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (st *systemTimer) C() <-chan time.Time {
+	return st.t.C
+}
+
+func (st *systemTimer) Stop() bool {
+	return st.t.Stop()
+}
+
+// ManualClock only moves when told to. Timers expire when the clock is
+// advanced to or beyond their deadline.
+type ManualClock struct {
+	mux    sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	mc := new(ManualClock)
+	mc.now = start
+	return mc
+}
+
+func (mc *ManualClock) Now() time.Time {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	return mc.now
+}
+
+func (mc *ManualClock) NewTimer(d time.Duration) ClockTimer {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mt := &manualTimer{clock: mc, deadline: mc.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		mt.ch <- mc.now
+	} else {
+		mc.timers = append(mc.timers, mt)
+	}
+	return mt
+}
+
+// Move the clock forward by the given duration.
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.Set(mc.Now().Add(d))
+}
+
+// Set the clock to the given time, which may also be in the past to
+// simulate a clock jump backwards.
+func (mc *ManualClock) Set(t time.Time) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.now = t
+	pending := mc.timers[:0]
+	for _, mt := range mc.timers {
+		if !mt.deadline.After(t) {
+			mt.ch <- t
+		} else {
+			pending = append(pending, mt)
+		}
+	}
+	mc.timers = pending
+}
+
+// Number of timers yet to expire; handy for tests to know when a component
+// has gone to sleep on the clock.
+func (mc *ManualClock) PendingTimers() int {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	return len(mc.timers)
+}
+
+type manualTimer struct {
+	clock    *ManualClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (mt *manualTimer) C() <-chan time.Time {
+	return mt.ch
+}
+
+func (mt *manualTimer) Stop() bool {
+	mt.clock.mux.Lock()
+	defer mt.clock.mux.Unlock()
+	for i, t := range mt.clock.timers {
+		if t == mt {
+			mt.clock.timers = append(mt.clock.timers[:i], mt.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"sync"
+)
+
+// CompletionService submits tasks to an execution service and yields their
+// responses in the order the tasks complete, as Java CompletionService does.
+// Tasks go through the dispatcher like any other, so responses are received
+// over the dispatcher response channels. Every response not consumed yet
+// holds up a go routine, so callers are expected to drain the channel.
+type CompletionService struct {
+	es        *ExecutionService
+	completed chan Response
+	mux       sync.Mutex
+	pending   int
+}
+
+func NewCompletionService(es *ExecutionService) *CompletionService {
+	cs := new(CompletionService)
+	cs.es = es
+	cs.completed = make(chan Response)
+	return cs
+}
+
+// Submit the task; its response appears on the Completed channel once the
+// task completes, including when it is cancelled through the context or the
+// returned future.
+func (cs *CompletionService) Submit(ctx context.Context, tsk Task) (error, *Future) {
+	err, f := cs.es.SubmitAsync(ctx, tsk)
+	if err != nil {
+		return err, nil
+	}
+	cs.mux.Lock()
+	cs.pending++
+	cs.mux.Unlock()
+	go func() {
+		resp := f.Get()
+		cs.completed <- *resp
+		cs.mux.Lock()
+		cs.pending--
+		cs.mux.Unlock()
+	}()
+	return nil, f
+}
+
+// Responses in completion order.
+func (cs *CompletionService) Completed() <-chan Response {
+	return cs.completed
+}
+
+// Next response in completion order, waiting until one is available or the
+// context is done in which case the context error is returned.
+func (cs *CompletionService) Take(ctx context.Context) (error, *Response) {
+	select {
+	case resp := <-cs.completed:
+		return nil, &resp
+	case <-ctx.Done():
+		return ctx.Err(), nil
+	}
+}
+
+// How many submitted tasks are yet to be taken.
+func (cs *CompletionService) Pending() int {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	return cs.pending
+}
@@ -0,0 +1,240 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpression is a parsed standard cron expression. Five fields are
+// minute, hour, day of month, month and day of week; six fields add seconds
+// in front. Each field accepts '*', '?' (day fields only), single values,
+// ranges 'a-b', steps '*/n' or 'a-b/n' and comma separated lists of these.
+// Months and week days can be given by their three letter English names.
+// Descriptors @yearly (@annually), @monthly, @weekly, @daily (@midnight) and
+// @hourly are supported as well. The expression can be prefixed with
+// 'CRON_TZ=<zone> ' (or 'TZ=<zone> ') to evaluate it in the given time zone.
+//
+// Like in the classic cron, when both day of month and day of week are
+// restricted, a day matches if either of them matches. As in Vixie cron, a
+// day field starting with '*', say '*/2', counts as unrestricted for this.
+type CronExpression struct {
+	second, minute, hour, dom, month, dow uint64 // bit i set if value i matches
+	domAny, dowAny                        bool
+	location                              *time.Location
+	text                                  string
+}
+
+type cronBounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSeconds = cronBounds{0, 59, nil}
+	cronMinutes = cronBounds{0, 59, nil}
+	cronHours   = cronBounds{0, 23, nil}
+	cronDom     = cronBounds{1, 31, nil}
+	cronMonths  = cronBounds{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted for Sunday as well and folded on to 0
+	cronDow = cronBounds{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse the cron expression; times are evaluated in the given location
+// unless the expression carries its own time zone. Nil location means local.
+func ParseCron(expr string, loc *time.Location) (*CronExpression, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	ce := new(CronExpression)
+	ce.text = expr
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid cron expression %q, missing fields after time zone", expr)
+		}
+		zone := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		loc, err = time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q in cron expression: %v", zone, err)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+	ce.location = loc
+	if strings.HasPrefix(spec, "@") {
+		full, ok := cronDescriptors[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron descriptor %q", spec)
+		}
+		spec = full
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %q, expected 5 or 6 fields but got %d", expr, len(fields))
+	}
+	var err error
+	if ce.second, err = parseCronField(fields[0], cronSeconds); err != nil {
+		return nil, err
+	}
+	if ce.minute, err = parseCronField(fields[1], cronMinutes); err != nil {
+		return nil, err
+	}
+	if ce.hour, err = parseCronField(fields[2], cronHours); err != nil {
+		return nil, err
+	}
+	if ce.dom, err = parseCronField(fields[3], cronDom); err != nil {
+		return nil, err
+	}
+	if ce.month, err = parseCronField(fields[4], cronMonths); err != nil {
+		return nil, err
+	}
+	if ce.dow, err = parseCronField(fields[5], cronDow); err != nil {
+		return nil, err
+	}
+	if ce.dow&(1<<7) != 0 {
+		ce.dow = ce.dow&^(1<<7) | 1
+	}
+	ce.domAny = strings.HasPrefix(fields[3], "*") || fields[3] == "?"
+	ce.dowAny = strings.HasPrefix(fields[5], "*") || fields[5] == "?"
+	return ce, nil
+}
+
+func parseCronField(field string, b cronBounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, step := b.min, b.max, 1
+		rangePart := part
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in cron field %q", field)
+			}
+			rangePart = part[:i]
+		}
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			ends := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = cronValue(ends[0], b); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(ends[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(rangePart, b)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+			// else 'a/n' means from a to the max in steps of n
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range in cron field %q", field)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, b cronBounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron value %q", s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("cron value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// How far ahead we look for a matching time before giving up; an expression
+// like '0 0 30 2 *' never matches.
+const cronSearchLimitYears = 5
+
+var errCronNoMatch = errors.New("cron expression never matches")
+
+// Next time strictly after the given one which matches the expression. Zero
+// time is returned if nothing matches within the next few years.
+func (ce *CronExpression) Next(after time.Time) time.Time {
+	t := after.In(ce.location).Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cronSearchLimitYears, 0, 0)
+	for t.Before(limit) {
+		if ce.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, ce.location)
+			continue
+		}
+		if !ce.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, ce.location)
+			continue
+		}
+		if ce.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, ce.location)
+			continue
+		}
+		if ce.minute&(1<<uint(t.Minute())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, ce.location)
+			continue
+		}
+		if ce.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (ce *CronExpression) dayMatches(t time.Time) bool {
+	domMatch := ce.dom&(1<<uint(t.Day())) != 0
+	dowMatch := ce.dow&(1<<uint(t.Weekday())) != 0
+	if ce.domAny || ce.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Location in which the expression is evaluated.
+func (ce *CronExpression) Location() *time.Location {
+	return ce.location
+}
+
+func (ce *CronExpression) String() string {
+	return ce.text
+}
@@ -0,0 +1,337 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"sync"
+	"time"
+)
+
+// What to do about the fire times which were missed; because the process was
+// paused, the clock jumped forward or the previous run of the job was still
+// in progress when the job was due again.
+type MissedFirePolicy int
+
+const (
+	// Missed fire times are dropped, the job runs at the next fire time.
+	MissedFireSkip MissedFirePolicy = iota
+
+	// All missed fire times are coalesced into a single run.
+	MissedFireOnce
+
+	// The job runs once for every missed fire time, one run after the other,
+	// up to the configured catch up limit.
+	MissedFireAll
+)
+
+// Cron scheduler configuration parameters
+type CronCfg struct {
+
+	// Time zone, as in the IANA database, in which cron expressions without
+	// their own time zone are evaluated. Empty means local time zone.
+	TimeZone string `json:"time_zone"`
+
+	// How late, in milliseconds, a fire can happen before it is regarded
+	// as missed.
+	MisfireThresholdMs int `json:"misfire_threshold_ms"`
+
+	// Upper limit on how many runs are owed to a job under MissedFireAll
+	// policy. Zero means no limit.
+	MaxCatchUpFires int `json:"max_catch_up_fires"`
+}
+
+// CronScheduler submits tasks to the execution service at wall clock times
+// matching their cron expressions. A single go routine sleeps on the clock
+// until the earliest job is due. Runs of the same job never overlap, a fire
+// time which arrives while the job is still running is handled as per the
+// missed fire policy of the job.
+type CronScheduler struct {
+	mux        sync.Mutex
+	es         *ExecutionService
+	clock      Clock
+	location   *time.Location
+	threshold  time.Duration
+	maxCatchUp int
+	jobs       map[int]*CronJob
+	lastJobId  int
+	lastNow    time.Time
+	wakeup     chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	running    bool
+}
+
+// A task registered with the cron scheduler.
+type CronJob struct {
+	id       int
+	sched    *CronScheduler
+	expr     *CronExpression
+	task     Task
+	policy   MissedFirePolicy
+	next     time.Time
+	inFlight bool
+	owed     int // runs due but not started yet
+	runs     int
+	failures int // fires which could not be submitted
+	missed   int
+	removed  bool
+}
+
+// Build a cron scheduler which submits tasks to the given execution service.
+// Nil clock means the system clock.
+func NewCronScheduler(cfg CronCfg, es *ExecutionService, clock Clock) (*CronScheduler, error) {
+	if es == nil {
+		return nil, errors.New("execution service is nil")
+	}
+	loc := time.Local
+	if len(cfg.TimeZone) > 0 {
+		var err error
+		loc, err = time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	cs := new(CronScheduler)
+	cs.es = es
+	cs.clock = clock
+	cs.location = loc
+	cs.threshold = time.Duration(cfg.MisfireThresholdMs) * time.Millisecond
+	cs.maxCatchUp = cfg.MaxCatchUpFires
+	cs.jobs = make(map[int]*CronJob)
+	cs.wakeup = make(chan struct{}, 1)
+	cs.ctx, cs.cancel = context.WithCancel(context.Background())
+	return cs, nil
+}
+
+func (cs *CronScheduler) Start() {
+	cs.mux.Lock()
+	cs.running = true
+	cs.lastNow = cs.clock.Now()
+	cs.mux.Unlock()
+	go cs.run()
+}
+
+// Stop the scheduler, runs in progress are cancelled.
+func (cs *CronScheduler) Stop() {
+	cs.mux.Lock()
+	cs.running = false
+	cs.mux.Unlock()
+	cs.cancel()
+}
+
+// Register the task to run at times matching the cron expression.
+func (cs *CronScheduler) AddJob(expr string, tsk Task, policy MissedFirePolicy) (error, *CronJob) {
+	if tsk == nil {
+		return ErrInvalidTask, nil
+	}
+	ce, err := ParseCron(expr, cs.location)
+	if err != nil {
+		return err, nil
+	}
+	next := ce.Next(cs.clock.Now())
+	if next.IsZero() {
+		return errCronNoMatch, nil
+	}
+	cs.mux.Lock()
+	cs.lastJobId++
+	job := &CronJob{id: cs.lastJobId, sched: cs, expr: ce, task: tsk, policy: policy, next: next}
+	cs.jobs[job.id] = job
+	cs.mux.Unlock()
+	cs.nudge()
+	return nil, job
+}
+
+// Remove the job, a run in progress is not affected.
+func (cs *CronScheduler) RemoveJob(job *CronJob) {
+	cs.mux.Lock()
+	job.removed = true
+	delete(cs.jobs, job.id)
+	cs.mux.Unlock()
+	cs.nudge()
+}
+
+func (cs *CronScheduler) nudge() {
+	select {
+	case cs.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (cs *CronScheduler) run() {
+	for {
+		var toRun []*CronJob
+		cs.mux.Lock()
+		now := cs.clock.Now()
+		if now.Before(cs.lastNow) {
+			// clock jumped backwards, fire times computed so far are too
+			// far in the future
+			for _, job := range cs.jobs {
+				job.next = job.expr.Next(now)
+			}
+		}
+		cs.lastNow = now
+		var earliest time.Time
+		for _, job := range cs.jobs {
+			if job.next.IsZero() {
+				continue
+			}
+			if !job.next.After(now) {
+				cs.collectFires(job, now)
+				if job.owed > 0 && !job.inFlight {
+					job.owed--
+					job.inFlight = true
+					toRun = append(toRun, job)
+				}
+			}
+			if !job.next.IsZero() && (earliest.IsZero() || job.next.Before(earliest)) {
+				earliest = job.next
+			}
+		}
+		cs.mux.Unlock()
+
+		// a submission may wait for a response channel or queue space,
+		// it must not delay the fire times of other jobs
+		for _, job := range toRun {
+			go cs.dispatch(job)
+		}
+
+		wait := time.Hour
+		if !earliest.IsZero() {
+			wait = earliest.Sub(now)
+		}
+		timer := cs.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-cs.wakeup:
+		case <-cs.ctx.Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// Work out how many fire times have passed for the job and how many runs it
+// is owed as per its missed fire policy. Caller holds the lock.
+func (cs *CronScheduler) collectFires(job *CronJob, now time.Time) {
+	fires := 0
+	last := job.next
+	t := job.next
+	for !t.IsZero() && !t.After(now) {
+		fires++
+		last = t
+		if cs.maxCatchUp > 0 && fires > cs.maxCatchUp {
+			// no point in walking through all of them
+			t = job.expr.Next(now)
+			last = now
+			break
+		}
+		t = job.expr.Next(t)
+	}
+	job.next = t
+	onTime := 0
+	if now.Sub(last) <= cs.threshold {
+		onTime = 1
+	}
+	owedBefore := job.owed
+	switch job.policy {
+	case MissedFireSkip:
+		if !job.inFlight {
+			job.owed = onTime
+		} else {
+			job.owed = 0
+		}
+	case MissedFireOnce:
+		job.owed = 1
+	case MissedFireAll:
+		job.owed += fires
+		if cs.maxCatchUp > 0 && job.owed > cs.maxCatchUp {
+			job.owed = cs.maxCatchUp
+		}
+	}
+	dropped := owedBefore + fires - job.owed
+	if dropped > 0 {
+		job.missed += dropped
+		util.LogDebug(fmt.Sprintf("Cron job %d (%s) missed %d fire times", job.id, job.expr, dropped))
+	}
+}
+
+func (cs *CronScheduler) dispatch(job *CronJob) {
+	err, f := cs.es.SubmitAsync(cs.ctx, job.task)
+	if err != nil {
+		util.Log(fmt.Sprintf("Failed to submit cron job %d (%s): %v", job.id, job.expr, err))
+		cs.runDone(job, false)
+		return
+	}
+	go func() {
+		f.Get()
+		cs.runDone(job, true)
+	}()
+}
+
+// The run is over, or it never started when not submitted; start the next one
+// if the job is owed any.
+func (cs *CronScheduler) runDone(job *CronJob, submitted bool) {
+	cs.mux.Lock()
+	if submitted {
+		job.runs++
+	} else {
+		job.failures++
+	}
+	job.inFlight = false
+	again := cs.running && !job.removed && job.owed > 0
+	if again {
+		job.owed--
+		job.inFlight = true
+	}
+	cs.mux.Unlock()
+	if again {
+		cs.dispatch(job)
+	}
+}
+
+// Id assigned by the scheduler.
+func (job *CronJob) Id() int {
+	return job.id
+}
+
+// The parsed cron expression of the job.
+func (job *CronJob) Expression() *CronExpression {
+	return job.expr
+}
+
+// How many times the job has run so far.
+func (job *CronJob) Runs() int {
+	job.sched.mux.Lock()
+	defer job.sched.mux.Unlock()
+	return job.runs
+}
+
+// How many fire times the job could not be submitted for, these are not runs.
+func (job *CronJob) Failures() int {
+	job.sched.mux.Lock()
+	defer job.sched.mux.Unlock()
+	return job.failures
+}
+
+// How many fire times were dropped as per the missed fire policy.
+func (job *CronJob) Missed() int {
+	job.sched.mux.Lock()
+	defer job.sched.mux.Unlock()
+	return job.missed
+}
+
+// When the job is due next.
+func (job *CronJob) Next() time.Time {
+	job.sched.mux.Lock()
+	defer job.sched.mux.Unlock()
+	return job.next
+}
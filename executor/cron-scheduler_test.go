@@ -0,0 +1,165 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2026, time.March, 14, 10, 20, 30, 0, time.UTC) // a Saturday
+
+	ce, err := ParseCron("*/15 * * * *", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.March, 14, 10, 30, 0, 0, time.UTC), ce.Next(start))
+
+	ce, err = ParseCron("0 30 2 * * MON-FRI", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.March, 16, 2, 30, 0, 0, time.UTC), ce.Next(start))
+
+	ce, err = ParseCron("@monthly", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), ce.Next(start))
+
+	// either day of month or day of week matches when both are restricted
+	ce, err = ParseCron("0 0 20 * 0", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC), ce.Next(start))
+	// a day field starting with '*' is unrestricted, both have to match
+	ce, err = ParseCron("0 0 */2 * MON", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.March, 23, 0, 0, 0, 0, time.UTC), ce.Next(start))
+
+	ce, err = ParseCron("CRON_TZ=Asia/Kolkata 0 9 * * *", time.UTC)
+	assert.Nil(err)
+	assert.Equal(time.Date(2026, time.March, 15, 3, 30, 0, 0, time.UTC), ce.Next(start).UTC())
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@never",
+		"TZ=Nowhere/City * * * * *"} {
+		_, err = ParseCron(bad, time.UTC)
+		assert.NotNil(err, bad)
+	}
+}
+
+func TestCronSchedulerMissedFires(t *testing.T) {
+	assert := assert.New(t)
+	clock := NewManualClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	cs, err := NewCronScheduler(es.ServiceCfgInUse.Cron, es, clock)
+	assert.Nil(err)
+
+	err, all := cs.AddJob("*/5 * * * * *", NewBlockingTestTask(10, false), MissedFireAll)
+	assert.Nil(err)
+	err, skip := cs.AddJob("*/5 * * * * *", NewBlockingTestTask(10, false), MissedFireSkip)
+	assert.Nil(err)
+	err, once := cs.AddJob("*/5 * * * * *", NewBlockingTestTask(10, false), MissedFireOnce)
+	assert.Nil(err)
+	cs.Start()
+	defer cs.Stop()
+
+	// waits till the scheduler has gone back to sleep on the clock after
+	// the expected runs are over
+	waitForCron := func(allRuns int, otherRuns int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if all.Runs() == allRuns && skip.Runs() == otherRuns && once.Runs() == otherRuns &&
+				clock.PendingTimers() == 1 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// on time fire
+	waitForCron(0, 0)
+	clock.Advance(5 * time.Second)
+	waitForCron(1, 1)
+	assert.Equal(1, all.Runs())
+	assert.Equal(1, skip.Runs())
+	assert.Equal(1, once.Runs())
+
+	// process is paused for 30 seconds, missing 6 fire times
+	clock.Advance(30 * time.Second)
+	waitForCron(7, 2)
+	assert.Equal(7, all.Runs())
+	assert.Equal(0, all.Missed())
+	// skip runs only the fire time which is on time now
+	assert.Equal(2, skip.Runs())
+	assert.Equal(5, skip.Missed())
+	// once coalesces all of them
+	assert.Equal(2, once.Runs())
+	assert.Equal(5, once.Missed())
+	assert.True(clock.Now().Add(5 * time.Second).Equal(all.Next()))
+
+	cs.RemoveJob(all)
+	clock.Advance(5 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(7, all.Runs())
+	assert.Zero(all.Failures())
+
+	// fires which cannot be submitted are failures rather than runs, here
+	// because a task with the same id is still in flight
+	release := make(chan struct{})
+	held := NewHeldTestTask(false, release)
+	err, f := es.SubmitAsync(context.Background(), held)
+	assert.Nil(err)
+	task := NewBlockingTestTask(10, false)
+	task.id = held.GetId()
+	err, dup := cs.AddJob("*/5 * * * * *", task, MissedFireAll)
+	assert.Nil(err)
+	clock.Advance(5 * time.Second)
+	assert.Eventually(func() bool {
+		return dup.Failures() == 1
+	}, time.Second, time.Millisecond)
+	assert.Zero(dup.Runs())
+	close(release)
+	f.Get()
+}
+
+func TestCronSchedulerBlockedSubmit(t *testing.T) {
+	assert := assert.New(t)
+	held := NewBlockingTestTask(10, false)
+	release := make(chan struct{})
+	cfg := es.CloneCfg()
+	// submission of the held task waits till released
+	cfg.Dispatcher.SubmitMiddleware = []SubmitMiddleware{func(next SubmitHandler) SubmitHandler {
+		return func(ctx context.Context, tsk Task) (error, *Response) {
+			if tsk.GetId() == held.GetId() {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return ctx.Err(), nil
+				}
+			}
+			return next(ctx, tsk)
+		}
+	}}
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+	clock := NewManualClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	cs, err := NewCronScheduler(cfg.Cron, testEs, clock)
+	assert.Nil(err)
+	err, heldJob := cs.AddJob("*/5 * * * * *", held, MissedFireSkip)
+	assert.Nil(err)
+	err, other := cs.AddJob("*/5 * * * * *", NewBlockingTestTask(10, false), MissedFireSkip)
+	assert.Nil(err)
+	cs.Start()
+	defer cs.Stop()
+
+	assert.Eventually(func() bool { return clock.PendingTimers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(5 * time.Second)
+	// the held submission neither delays the other job nor its next fire time
+	assert.Eventually(func() bool { return other.Runs() == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(func() bool { return clock.PendingTimers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(5 * time.Second)
+	assert.Eventually(func() bool { return other.Runs() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(0, heldJob.Runs())
+
+	close(release)
+	assert.Eventually(func() bool { return heldJob.Runs() == 1 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,254 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// What happens to the rest of a Dag when one of its tasks does not complete
+// successfully.
+type DagFailurePolicy int
+
+const (
+	// No more tasks are submitted and the ones in flight are cancelled.
+	DagFailFast DagFailurePolicy = iota
+
+	// Tasks depending, directly or indirectly, on the failed task are
+	// skipped; all others run to completion.
+	DagContinueIndependent
+)
+
+// Optional interface a task in a Dag can implement to receive responses of
+// the tasks it depends on, keyed by task id, just before it is submitted.
+type DagTask interface {
+	Task
+
+	ReceiveUpstream(responses map[int]Response)
+}
+
+// Directed acyclic graph of tasks where a task is submitted only after all
+// the tasks it depends on complete successfully. Independent branches run
+// concurrently on the executor pool. Built with a DagBuilder, a Dag can be
+// executed any number of times.
+type Dag struct {
+	nodes  map[int]*dagNode
+	order  []int // topological order
+	policy DagFailurePolicy
+}
+
+type dagNode struct {
+	task       Task
+	deps       []int
+	dependents []int
+}
+
+// Builds a Dag, tasks are identified by their ids which must be unique.
+type DagBuilder struct {
+	policy DagFailurePolicy
+	tasks  []Task
+	deps   map[int][]Task
+	err    error
+}
+
+// Collected outcome of a Dag execution.
+type DagResult struct {
+
+	// Responses of the tasks which were submitted, keyed by task id.
+	Responses map[int]Response
+
+	// Ids of the tasks which did not complete successfully, in the order
+	// they ended.
+	Failed []int
+
+	// Ids of the tasks which were never submitted because a task upstream
+	// failed, in topological order.
+	Skipped []int
+}
+
+func NewDagBuilder(policy DagFailurePolicy) *DagBuilder {
+	db := new(DagBuilder)
+	db.policy = policy
+	db.deps = make(map[int][]Task)
+	return db
+}
+
+// Add the task which depends on the given tasks; they can be added before or
+// after this one.
+func (db *DagBuilder) Add(tsk Task, dependsOn ...Task) *DagBuilder {
+	if tsk == nil {
+		db.err = ErrInvalidTask
+		return db
+	}
+	db.tasks = append(db.tasks, tsk)
+	db.deps[tsk.GetId()] = append(db.deps[tsk.GetId()], dependsOn...)
+	return db
+}
+
+// Validate the graph and build the Dag. Duplicate task ids, dependencies on
+// tasks not added and dependency cycles are errors.
+func (db *DagBuilder) Build() (*Dag, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	dag := new(Dag)
+	dag.policy = db.policy
+	dag.nodes = make(map[int]*dagNode, len(db.tasks))
+	for _, tsk := range db.tasks {
+		if dag.nodes[tsk.GetId()] != nil {
+			return nil, fmt.Errorf("duplicate task id %d", tsk.GetId())
+		}
+		dag.nodes[tsk.GetId()] = &dagNode{task: tsk}
+	}
+	for _, tsk := range db.tasks {
+		node := dag.nodes[tsk.GetId()]
+		for _, dep := range db.deps[tsk.GetId()] {
+			if dep == nil || dag.nodes[dep.GetId()] == nil {
+				return nil, fmt.Errorf("task %d depends on a task which is not added", tsk.GetId())
+			}
+			node.deps = append(node.deps, dep.GetId())
+			upstream := dag.nodes[dep.GetId()]
+			upstream.dependents = append(upstream.dependents, tsk.GetId())
+		}
+	}
+	if err := dag.sort(db.tasks); err != nil {
+		return nil, err
+	}
+	return dag, nil
+}
+
+// Kahn's algorithm; whatever cannot be ordered is part of or behind a cycle.
+func (dag *Dag) sort(tasks []Task) error {
+	pending := make(map[int]int, len(dag.nodes))
+	var ready []int
+	for _, tsk := range tasks {
+		id := tsk.GetId()
+		pending[id] = len(dag.nodes[id].deps)
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		dag.order = append(dag.order, id)
+		for _, d := range dag.nodes[id].dependents {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(dag.order) < len(dag.nodes) {
+		var cyclic []int
+		for id, n := range pending {
+			if n > 0 {
+				cyclic = append(cyclic, id)
+			}
+		}
+		sort.Ints(cyclic)
+		return fmt.Errorf("dependency cycle among tasks %v", cyclic)
+	}
+	return nil
+}
+
+type dagEvent struct {
+	id   int
+	resp Response
+}
+
+// Execute the Dag and wait for it to finish. Tasks are submitted as soon as
+// their dependencies complete successfully, regardless of whether they are
+// blocking or not. Error returned is nil only if every task completed
+// successfully; otherwise it is the context error if the context is done,
+// whatever the failure policy, or else ErrDagFailed; the result tells the
+// outcome of each task.
+func (es *ExecutionService) ExecuteDag(ctx context.Context, dag *Dag) (error, *DagResult) {
+	callerCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := &DagResult{Responses: make(map[int]Response, len(dag.nodes))}
+	// every task ends with exactly one event, so sending never blocks
+	events := make(chan dagEvent, len(dag.nodes))
+	pending := make(map[int]int, len(dag.nodes))
+	blocked := make(map[int]bool)
+	inFlight := 0
+	stopped := false
+	var failure error
+
+	submit := func(id int) {
+		node := dag.nodes[id]
+		if dt, ok := node.task.(DagTask); ok {
+			upstream := make(map[int]Response, len(node.deps))
+			for _, dep := range node.deps {
+				upstream[dep] = result.Responses[dep]
+			}
+			dt.ReceiveUpstream(upstream)
+		}
+		inFlight++
+		err, f := es.SubmitAsync(ctx, node.task)
+		if err != nil {
+			resp := FailedToSubmitResponse(id)
+			resp.Errors = []error{err}
+			events <- dagEvent{id, *resp}
+			return
+		}
+		go func() {
+			events <- dagEvent{id, *f.Get()}
+		}()
+	}
+
+	for _, id := range dag.order {
+		pending[id] = len(dag.nodes[id].deps)
+		if pending[id] == 0 {
+			submit(id)
+		}
+	}
+	for inFlight > 0 {
+		ev := <-events
+		inFlight--
+		result.Responses[ev.id] = ev.resp
+		if ev.resp.Status != TaskStatusCompletedSuccessfully {
+			result.Failed = append(result.Failed, ev.id)
+			if failure == nil {
+				failure = fmt.Errorf("%w: task %d ended with status %d", ErrDagFailed, ev.id, ev.resp.Status)
+			}
+			if dag.policy == DagFailFast {
+				stopped = true
+				cancel()
+			} else {
+				dag.block(ev.id, blocked)
+			}
+			continue
+		}
+		for _, d := range dag.nodes[ev.id].dependents {
+			pending[d]--
+			if pending[d] == 0 && !blocked[d] && !stopped && ctx.Err() == nil {
+				submit(d)
+			}
+		}
+	}
+	for _, id := range dag.order {
+		if _, ran := result.Responses[id]; !ran {
+			result.Skipped = append(result.Skipped, id)
+		}
+	}
+	if err := callerCtx.Err(); err != nil {
+		// caller gave up, tasks failing since are likely cancelled by it
+		failure = err
+	}
+	return failure, result
+}
+
+// Mark everything downstream of the task as not to be submitted.
+func (dag *Dag) block(id int, blocked map[int]bool) {
+	for _, d := range dag.nodes[id].dependents {
+		if !blocked[d] {
+			blocked[d] = true
+			dag.block(d, blocked)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDagDiamond(t *testing.T) {
+	assert := assert.New(t)
+	a := NewBlockingTestTask(100, false)
+	b := NewUpstreamTestTask(100, true)
+	c := NewUpstreamTestTask(100, false)
+	d := NewUpstreamTestTask(100, true)
+	// dependencies may be added ahead of the tasks they refer to
+	dag, err := NewDagBuilder(DagFailFast).Add(d, b, c).Add(b, a).Add(c, a).Add(a).Build()
+	assert.Nil(err)
+
+	err, result := es.ExecuteDag(context.Background(), dag)
+	assert.Nil(err)
+	assert.Len(result.Responses, 4)
+	assert.Empty(result.Failed)
+	assert.Empty(result.Skipped)
+	for _, resp := range result.Responses {
+		assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	}
+	assert.Equal([]int{a.GetId()}, keys(b.upstream))
+	assert.ElementsMatch([]int{b.GetId(), c.GetId()}, keys(d.upstream))
+	assert.Equal(TaskStatusCompletedSuccessfully, d.upstream[c.GetId()].Status)
+}
+
+func TestDagBuildErrors(t *testing.T) {
+	assert := assert.New(t)
+	a := NewTestTask(10)
+	b := NewTestTask(10)
+	c := NewTestTask(10)
+	_, err := NewDagBuilder(DagFailFast).Add(a, c).Add(b, a).Add(c, b).Build()
+	assert.ErrorContains(err, "cycle")
+	_, err = NewDagBuilder(DagFailFast).Add(a, c).Build()
+	assert.NotNil(err)
+	_, err = NewDagBuilder(DagFailFast).Add(a).Add(a).Build()
+	assert.NotNil(err)
+	_, err = NewDagBuilder(DagFailFast).Add(nil).Build()
+	assert.ErrorIs(err, ErrInvalidTask)
+}
+
+func TestDagFailurePolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	// a fails, so b which depends on it is skipped either way
+	a := NewFlakyTestTask(1, false, nil)
+	b := NewTestTask(10)
+	c := NewTestTask(10)
+	dag, err := NewDagBuilder(DagContinueIndependent).Add(a).Add(b, a).Add(c).Build()
+	assert.Nil(err)
+	err, result := es.ExecuteDag(context.Background(), dag)
+	assert.ErrorIs(err, ErrDagFailed)
+	assert.Equal([]int{a.GetId()}, result.Failed)
+	assert.Equal([]int{b.GetId()}, result.Skipped)
+	assert.Equal(TaskStatusCompletedSuccessfully, result.Responses[c.GetId()].Status)
+
+	// with fail fast, nothing is submitted after the failure
+	a = NewFlakyTestTask(1, false, nil)
+	b = NewTestTask(10)
+	c = NewTestTask(10)
+	dag, err = NewDagBuilder(DagFailFast).Add(a).Add(b, a).Add(c, b).Build()
+	assert.Nil(err)
+	err, result = es.ExecuteDag(context.Background(), dag)
+	assert.ErrorIs(err, ErrDagFailed)
+	assert.Equal([]int{b.GetId(), c.GetId()}, result.Skipped)
+}
+
+func TestDagCancelledFailFast(t *testing.T) {
+	assert := assert.New(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	a := NewProbeTestTask(false, func() {
+		close(started)
+		<-release
+	})
+	b := NewTestTask(10)
+	dag, err := NewDagBuilder(DagFailFast).Add(a).Add(b, a).Build()
+	assert.Nil(err)
+
+	// the caller gives up while the task runs, that is what is reported
+	// rather than the task cancelled along
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	err, result := es.ExecuteDag(ctx, dag)
+	close(release)
+	assert.ErrorIs(err, context.Canceled)
+	assert.Equal(TaskStatusCancelled, result.Responses[a.GetId()].Status)
+	assert.Equal([]int{b.GetId()}, result.Skipped)
+}
+
+func keys(m map[int]Response) []int {
+	var result []int
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
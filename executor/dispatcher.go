@@ -4,20 +4,32 @@
 package executor
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/umeshgeeta/goshared/util"
+	"time"
 )
 
 // Dispatcher type which hold reference to executor pool, channels used for
 // getting back task execution results and go routines waiting on task results.
+//
+// Dispatcher is terminated after a shutdown once the executor pool is
+// terminated and every submitted task has been accounted for; only then the
+// response channel listeners are stopped.
 type Dispatcher struct {
-	execPool     *ExecutorPool
-	respChans    *responseChannels
-	chanCount    int
-	waitForChan  bool
-	waitingTasks map[int]waitingTask
-	JobStats     *TaskStats
+	execPool         *ExecutorPool
+	respChans        *responseChannels
+	chanCount        int
+	waitForChan      bool
+	lc               *lifecycle
+	waitingTasks     *waitingTaskRegistry
+	submissions      *submissionLog
+	retryPolicy      *RetryPolicy // default for tasks without one of their own
+	rejectionPolicy  RejectionPolicy
+	rejectionHandler RejectionHandler
+	tracer           Tracer
+	submitMiddleware []SubmitMiddleware
+	JobStats         *TaskStats
 }
 
 type DispatcherCfg struct {
@@ -31,6 +43,24 @@ type DispatcherCfg struct {
 	// Whether caller should wait for response channel availability while
 	// submitting a task
 	WaitForChanAvail bool `json:"wait_for_chan_avail"`
+
+	// What to do with a task when no channel is available and we are not
+	// waiting for one. Empty means RejectAbort.
+	RejectionPolicy RejectionPolicy `json:"rejection_policy"`
+
+	// Overrides the rejection policy if set, only programmatically.
+	RejectionHandler RejectionHandler `json:"-"`
+
+	// How many finished submissions are remembered for Lookup; zero means
+	// only submissions in flight can be looked up.
+	SubmissionHistorySize int `json:"submission_history_size"`
+
+	// Notified along the life of every task submitted, only programmatically.
+	Tracer Tracer `json:"-"`
+
+	// Wraps every submission, the first one being the outermost; only
+	// programmatically.
+	SubmitMiddleware []SubmitMiddleware `json:"-"`
 }
 
 // create a dispatcher with the given number of Response channel counts
@@ -54,90 +84,251 @@ type DispatcherCfg struct {
 // the task result. It does not apply for async tasks.
 func NewDispatcher(cfg DispatcherCfg, ep *ExecutorPool) *Dispatcher {
 	var disp Dispatcher
-	disp.waitingTasks = make(map[int]waitingTask)
-	disp.respChans = newRC(cfg.ChannelCount, cfg.ChannelCapacity, cfg.WaitForChanAvail, &disp.waitingTasks)
+	disp.waitingTasks = newWaitingTaskRegistry()
+	disp.submissions = newSubmissionLog(cfg.SubmissionHistorySize)
+	disp.respChans = newRC(cfg.ChannelCount, cfg.ChannelCapacity, cfg.WaitForChanAvail, disp.waitingTasks.get)
 	disp.execPool = ep
 	disp.waitForChan = cfg.WaitForChanAvail
 	disp.chanCount = cfg.ChannelCount
+	disp.rejectionPolicy = cfg.RejectionPolicy
+	disp.rejectionHandler = cfg.RejectionHandler
+	disp.tracer = cfg.Tracer
+	disp.submitMiddleware = cfg.SubmitMiddleware
 	disp.JobStats = newTaskStats()
+	disp.lc = newLifecycle()
+	ep.stats = disp.JobStats
+	ep.observer = disp.taskEvent
 	return &disp
 }
 
-func (disp *Dispatcher) Start() {
-	disp.execPool.Start()
+// Start the executor pool and the response channel listeners. The dispatcher
+// can be started only once.
+func (disp *Dispatcher) Start() error {
+	if err := disp.lc.start(); err != nil {
+		return err
+	}
+	if err := disp.execPool.Start(); err != nil {
+		return err
+	}
 	disp.respChans.start()
+	return nil
 }
 
 func (disp *Dispatcher) Submit(tsk Task) (error, *Response) {
+	return disp.SubmitContext(context.Background(), tsk)
+}
+
+// Submit the task honouring cancellation and deadline of the given context
+// while waiting for a response channel, for space in the executor queue and,
+// for blocking tasks, for the task result. When the context is done first,
+// the context error is returned along with a response of status
+// TaskStatusCancelled for blocking tasks. For async tasks the response has
+// status TaskStatusSubmitted and carries the submission id by which the task
+// can be looked up later.
+//
+// Task ids are chosen by the client, so submitting a task while another task
+// with the same id is in flight fails with ErrDuplicateTaskId.
+func (disp *Dispatcher) SubmitContext(ctx context.Context, tsk Task) (error, *Response) {
 	var err error = nil
 	var resp *Response = nil
 	if tsk != nil {
-		err, resp = disp.submitTask(tsk)
-		if err == nil {
-			// there is no error in submitting the job, we start counting
-			disp.JobStats.taskSubmitted(tsk.IsBlocking())
-		}
+		err, resp = disp.submitThrough(ctx, tsk, nil)
 	} else {
-		err = errors.New("invalid task")
+		err = ErrInvalidTask
 	}
 	return err, resp
 }
 
+// Submit the task without waiting for its execution, regardless of whether
+// it is a blocking task or not, and return a Future through which the response
+// can be collected later. The context governs waiting for a response channel
+// and for the executor queue space; cancelling it later also cancels the
+// returned future.
+func (disp *Dispatcher) SubmitAsync(ctx context.Context, tsk Task) (error, *Future) {
+	if tsk == nil {
+		return ErrInvalidTask, nil
+	}
+	fctx, cancel := context.WithCancel(ctx)
+	f := newFuture(tsk.GetId(), cancel)
+	err, _ := disp.submitThrough(fctx, tsk, f)
+	if err != nil {
+		cancel()
+		return err, nil
+	}
+	// the future ought to be cancelled along with the caller context
+	go func() {
+		select {
+		case <-fctx.Done():
+			f.Cancel()
+		case <-f.done:
+		}
+	}()
+	return nil, f
+}
+
 type waitingTask struct {
-	cond             *util.CondVar
+	submissionId     uint64
 	responseReceived bool
 	taskResponse     Response
-	blocking         bool // whether task for which we will be waiting, is it blocking or not
+	blocking         bool          // whether task for which we will be waiting, is it blocking or not
+	submitted        bool          // whether the task made it to an executor queue
+	respReady        chan struct{} // closed once taskResponse is populated
+	chanIndex        int           // of the response channel the task holds
+	future           *Future       // if the caller is going to collect response later
+	disp             *Dispatcher
+	task             Task
+	ctx              context.Context // submission context, retries are given up when it is done
+	retry            *RetryPolicy
+	attempts         int
+	errs             []error  // of the failed attempts so far
+	info             TaskInfo // final, once the response is ready
+}
+
+// Response reported back by an executor. A failed attempt is retried as per
+// the retry policy, otherwise the response is recorded along with errors of
+// the earlier attempts.
+func (wt *waitingTask) received(tr Response) {
+	wt.attempts++
+	if wt.retry.shouldRetry(tr, wt.attempts) {
+		wt.errs = append(wt.errs, tr.Errors...)
+		wt.disp.JobStats.taskRetried()
+		wt.disp.submissions.requeued(wt.submissionId)
+		go wt.retryAfter(wt.retry.backoff(wt.attempts), tr)
+		return
+	}
+	tr.Attempts = wt.attempts
+	tr.Errors = append(wt.errs, tr.Errors...)
+	wt.respond(tr)
+}
+
+// Re-submit the task after the backoff. If the caller gives up meanwhile or
+// the task cannot be submitted again, the last failed response is recorded.
+func (wt *waitingTask) retryAfter(backoff time.Duration, last Response) {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-wt.ctx.Done():
+	}
+	err := wt.ctx.Err()
+	if err == nil {
+		util.LogDebug(fmt.Sprintf("Retrying task %d, attempt %d", wt.task.GetId(), wt.attempts+1))
+		if err = wt.disp.execPool.SubmitContext(wt.ctx, wt.task); err == nil {
+			return
+		}
+	}
+	last.Attempts = wt.attempts
+	last.Errors = append(wt.errs, err)
+	wt.respond(last)
 }
 
-func addNewWaitingTask(disp *Dispatcher, chanIndex int, tsk Task) *waitingTask {
+// Record the response and release every routine waiting for it. It is
+// invoked exactly once per waiting task; either by the channel listener
+// or by the dispatcher when the task never reached an executor.
+func (wt *waitingTask) respond(tr Response) {
+	disp := wt.disp
+	tr.SubmissionId = wt.submissionId
+	wt.taskResponse = tr
+	wt.responseReceived = true
+	util.LogDebug(fmt.Sprintf("wait done! waitingTask: %v", wt))
+	// the task id and the channel are released before the response can be
+	// had anywhere, so the same task can be submitted again right after
+	disp.waitingTasks.remove(wt.task.GetId(), wt)
+	disp.respChans.markAvailable(wt.chanIndex)
+	// recorded before anyone is released, so a lookup right after finds it
+	wt.info = disp.submissions.done(wt.submissionId, tr)
+	if disp.tracer != nil {
+		disp.tracer.ResponseDelivered(wt.ctx, tr)
+	}
+	// as well as count the job done, provided it was ever counted
+	if wt.submitted {
+		disp.JobStats.taskDone(wt.info)
+	}
+	close(wt.respReady)
+	// hand over the response to the future, if any
+	if wt.future != nil {
+		wt.future.complete(wt.taskResponse)
+	}
+	// it comes last so that once no task is waiting, the book keeping is all
+	// settled for the shutdown
+	disp.waitingTasks.settled()
+}
+
+// Returns nil if a task with the same id is already waiting.
+func addNewWaitingTask(disp *Dispatcher, chanIndex int, ctx context.Context, tsk Task, f *Future) *waitingTask {
 	r := new(waitingTask)
+	r.future = f
+	r.disp = disp
+	r.task = tsk
+	r.ctx = ctx
+	r.retry = taskRetryPolicy(tsk, disp.retryPolicy)
 	// track whether the task is blocking or not
 	r.blocking = tsk.IsBlocking()
-	r.cond = util.NewCondVar(10, 100)
-	// update the internal map
-	disp.waitingTasks[tsk.GetId()] = *r
+	r.respReady = make(chan struct{})
+	r.chanIndex = chanIndex
+	// update the internal map, unless the task id is taken
+	if !disp.waitingTasks.add(tsk.GetId(), r) {
+		return nil
+	}
+	disp.submissions.started(r)
+	if f != nil {
+		f.submissionId = r.submissionId
+	}
 	util.LogDebug(fmt.Sprintf("WaitingTask %v for task (id=%d) created", r, tsk.GetId()))
-	// We start a go routine which will be waiting on this condition.
-	// It is guaranteed that the go routine spawned will not go into infinite
-	// loop because, the task is yet to be submitted. In other words, we do all
-	// the house keeping work like setting up the listener for the response
-	// before any response upon execution can be ever created.
-	go func(wt *waitingTask) {
-		for !wt.responseReceived {
-			util.LogDebug(fmt.Sprintf("Starting wait. waitingTask: %v", wt))
-			wt.cond.Wait()
-			// read back from the map
-			var updatedWt waitingTask = disp.waitingTasks[tsk.GetId()]
-			wt = &updatedWt
-			util.LogDebug(fmt.Sprintf("wait done! waitingTask: %v", wt))
-		}
-		util.LogDebug(fmt.Sprintf("Waiting done for cond %v", wt.cond))
-		// get hold of the response....
-		tr := wt.taskResponse
-		// next remove the map entry
-		delete(disp.waitingTasks, tr.TaskId)
-		// and finally we need to mark channel as available
-		disp.respChans.markAvailable(chanIndex)
-		// as well as count the job done
-		disp.JobStats.taskDone(wt.blocking)
-	}(r)
+	// All the house keeping, releasing the channel and the entry, is done
+	// when the response is recorded; see respond.
 	return r
 }
 
-func (disp *Dispatcher) submitTask(tsk Task) (error, *Response) {
+// Submit the task through the submit middleware, if any.
+func (disp *Dispatcher) submitThrough(ctx context.Context, tsk Task, f *Future) (error, *Response) {
+	if len(disp.submitMiddleware) == 0 {
+		return disp.submitTask(ctx, tsk, f)
+	}
+	inner := func(ctx context.Context, tsk Task) (error, *Response) {
+		return disp.submitTask(ctx, tsk, f)
+	}
+	return ChainSubmit(inner, disp.submitMiddleware...)(ctx, tsk)
+}
+
+// When the future is not nil, caller is not waiting for the response even if
+// the task is blocking; the response is delivered to the future instead.
+func (disp *Dispatcher) submitTask(ctx context.Context, tsk Task, f *Future) (error, *Response) {
 	var err error = nil
 	var resp *Response = nil
+	switch disp.lc.get() {
+	case StateNew:
+		return ErrNotStarted, nil
+	case StateShuttingDown, StateTerminated:
+		return ErrShutdown, nil
+	}
 	// we have to get a channel on which we will wait for the response
-	i, ai := disp.respChans.nextAvailChanIndex()
+	i, ai := disp.respChans.nextAvailChanIndex(ctx)
 	if ai != nil {
 		// we got a valid channel to use here
 		// set in the task so executor can use
 		tsk.SetRespChan(ai)
 		// before submit task, create a listener to receive any response
-		nwt := addNewWaitingTask(disp, i, tsk)
+		nwt := addNewWaitingTask(disp, i, ctx, tsk, f)
+		if nwt == nil {
+			disp.respChans.markAvailable(i)
+			return ErrDuplicateTaskId, nil
+		}
+		if disp.tracer != nil {
+			// the rest of the task life, including retries, is traced
+			// under whatever the tracer puts in the context
+			ctx = disp.tracer.TaskSubmitted(ctx, tsk, nwt.submissionId)
+			nwt.ctx = ctx
+		}
+		nwt.submitted = true
+		// in execution before the hand over as the executor may respond right
+		// away, say when it runs the task itself as per the rejection policy
+		disp.JobStats.taskHandedOver()
 		// try submitting the task for the execution, we are waiting in nwt
-		err = disp.execPool.Submit(tsk)
+		err = disp.execPool.SubmitContext(ctx, tsk)
+		if err == nil {
+			disp.JobStats.taskSubmitted(tsk.IsBlocking())
+		}
 		// If no error, we have been able to submit successfully
 		// and go routine is started to undertake house keeping
 		// when the result comes back. We do not have anything here
@@ -149,31 +340,139 @@ func (disp *Dispatcher) submitTask(tsk Task) (error, *Response) {
 			// The way we achieve that is by setting a special error response
 			// so that the house keeping go routine which is waiting will
 			// exit and normal steps of house keeping will be executed.
-			nwt.taskResponse = *FailedToSubmitResponse(tsk.GetId())
+			nwt.submitted = false
+			disp.JobStats.handOverFailed()
+			if ctx.Err() != nil {
+				nwt.respond(*CancelledResponse(tsk.GetId()))
+			} else {
+				disp.JobStats.taskRejected(tsk.IsBlocking())
+				nwt.respond(*FailedToSubmitResponse(tsk.GetId()))
+			}
 		} else {
 			// else the task was submitted successfully with another go routine
 			// waiting to undertake house keeping when the execution response
-			// appears on the listening channel
-
+			// appears on the listening channel.
 			// However if this is a blocking task, we need to wait here
-			// for the response from execution as well.
-			if tsk.IsBlocking() {
-				for !nwt.responseReceived {
-					nwt.cond.Wait()
-					// get the updated copy
-					var updatedWt waitingTask = disp.waitingTasks[tsk.GetId()]
-					nwt = &updatedWt
+			// for the response from execution as well. If the caller gives
+			// up in between, the house keeping routine still releases the
+			// channel once the executor reports back (executor skips the
+			// task altogether if it has not started it yet).
+			if tsk.IsBlocking() && f == nil {
+				select {
+				case <-nwt.respReady:
+					resp = &nwt.taskResponse
+				case <-ctx.Done():
+					err = ctx.Err()
+					resp = CancelledResponse(tsk.GetId())
+					resp.SubmissionId = nwt.submissionId
 				}
-				resp = &nwt.taskResponse
+			} else if f == nil {
+				resp = NewResponse(tsk.GetId())
+				resp.Status = TaskStatusSubmitted
+				resp.SubmissionId = nwt.submissionId
 			}
 		}
+	} else if ctx.Err() != nil {
+		err = ctx.Err()
 	} else {
-		err = errors.New("cannot submit, no channel available")
+		err, resp = disp.reject(ctx, tsk, f)
 	}
 	return err, resp
 }
 
+// Executors report what happens to tasks through the pool.
+func (disp *Dispatcher) taskEvent(ev taskEvent, tsk Task, executor int, resp *Response) {
+	if ev == taskStarted {
+		disp.submissions.running(tsk.GetId(), executor)
+	}
+	if disp.tracer == nil {
+		return
+	}
+	wt := disp.waitingTasks.get(tsk.GetId())
+	if wt == nil {
+		return
+	}
+	tsk = unwrapTask(tsk)
+	switch ev {
+	case taskDequeued:
+		disp.tracer.TaskDequeued(wt.ctx, tsk, executor)
+	case taskStarted:
+		disp.tracer.TaskStarted(wt.ctx, tsk, executor)
+	case taskEnded:
+		disp.tracer.TaskEnded(wt.ctx, tsk, executor, *resp)
+	}
+}
+
+// Stop accepting tasks; tasks already submitted are still executed and their
+// responses delivered. Use AwaitTermination to wait for them to finish.
+func (disp *Dispatcher) Shutdown() {
+	prev := disp.lc.shutdown()
+	disp.execPool.Shutdown()
+	disp.awaitTasks(prev)
+}
+
+// Stop accepting tasks and return the submitted tasks which were never
+// started. Callers waiting for those tasks receive a response of status
+// TaskStatusCancelled. Tasks in execution are allowed to finish.
+func (disp *Dispatcher) ShutdownNow() []Task {
+	prev := disp.lc.shutdown()
+	dropped := disp.execPool.ShutdownNow()
+	for _, tsk := range dropped {
+		if wt := disp.waitingTasks.get(tsk.GetId()); wt != nil {
+			wt.respond(*CancelledResponse(tsk.GetId()))
+		}
+	}
+	disp.awaitTasks(prev)
+	return dropped
+}
+
+// The dispatcher was running before the shutdown, so it terminates once the
+// pool is terminated and all responses are handed over. Done in a separate go
+// routine so that shutdown methods do not block.
+func (disp *Dispatcher) awaitTasks(prev LifecycleState) {
+	if prev != StateRunning {
+		return
+	}
+	go func() {
+		disp.execPool.AwaitTermination(context.Background())
+		disp.waitingTasks.awaitEmpty()
+		disp.respChans.stop()
+		disp.lc.terminate()
+	}()
+}
+
+// Wait until the dispatcher is terminated after a shutdown or the context is
+// done, in which case the context error is returned.
+func (disp *Dispatcher) AwaitTermination(ctx context.Context) error {
+	return disp.lc.await(ctx)
+}
+
+func (disp *Dispatcher) State() LifecycleState {
+	return disp.lc.get()
+}
+
+// Response of the submission with the given id; status is TaskStatusSubmitted
+// while the task is in flight. Finished submissions are remembered as per the
+// configured history size, false is returned for the ones forgotten and for
+// unknown ids.
+func (disp *Dispatcher) Lookup(submissionId uint64) (*Response, bool) {
+	return disp.submissions.lookup(submissionId)
+}
+
+// State of the submission with the given id along with the executor running
+// it and when it was submitted, started and ended. Like Lookup, false is
+// returned for unknown or forgotten submissions.
+func (disp *Dispatcher) Status(submissionId uint64) (TaskInfo, bool) {
+	return disp.submissions.status(submissionId)
+}
+
+// Submissions queued or running at present, oldest first.
+func (disp *Dispatcher) ListInFlight() []TaskInfo {
+	return disp.submissions.listInFlight()
+}
+
+// Same as ShutdownNow, but tasks never started are simply dropped after
+// cancelling them.
 func (disp *Dispatcher) Stop() {
-	disp.execPool.Stop()
-	disp.respChans.stop()
+	disp.ShutdownNow()
 }
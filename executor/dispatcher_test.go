@@ -0,0 +1,96 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Many go routines submit concurrently through few small response channels,
+// so that channels are claimed and released all the time while listeners and
+// house keeping routines work on the waiting tasks. Meant to be run with the
+// race detector.
+func TestDispatcherConcurrentLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	ep := NewExecutorPool(ExecPoolCfg{AsyncTaskExecutorCount: 4, BlockingTaskExecutorCount: 4},
+		ExecCfg{TaskQueueCapacity: 16, WaitForAvailability: true})
+	const submitters = 20
+	const tasksPerSubmitter = 25
+	disp := NewDispatcher(DispatcherCfg{ChannelCount: 3, ChannelCapacity: 2, WaitForChanAvail: true,
+		SubmissionHistorySize: submitters * tasksPerSubmitter}, ep)
+	assert.Nil(disp.Start())
+
+	// task ids are handed out by a global counter, so tasks are created here
+	tasks := make([][]*TestTask, submitters)
+	for s := range tasks {
+		for i := 0; i < tasksPerSubmitter; i++ {
+			tasks[s] = append(tasks[s], NewBlockingTestTask(10, i%2 == 0))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	responses := make(chan Response, submitters*tasksPerSubmitter)
+	// async tasks are looked up once all is over
+	asyncIds := make(chan uint64, submitters*tasksPerSubmitter)
+	var wg sync.WaitGroup
+	for s := 0; s < submitters; s++ {
+		wg.Add(1)
+		go func(batch []*TestTask) {
+			defer wg.Done()
+			for i, tsk := range batch {
+				if i%3 == 0 {
+					err, f := disp.SubmitAsync(ctx, tsk)
+					if assert.Nil(err) {
+						resp := f.Get()
+						responses <- *resp
+					}
+					continue
+				}
+				err, resp := disp.SubmitContext(ctx, tsk)
+				if !assert.Nil(err) {
+					continue
+				}
+				if tsk.IsBlocking() {
+					responses <- *resp
+				} else {
+					asyncIds <- resp.SubmissionId
+				}
+			}
+		}(tasks[s])
+	}
+	wg.Wait()
+	close(responses)
+	close(asyncIds)
+
+	disp.Shutdown()
+	assert.Nil(disp.AwaitTermination(ctx))
+
+	count := 0
+	for resp := range responses {
+		count++
+		assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	}
+	for id := range asyncIds {
+		count++
+		resp, found := disp.Lookup(id)
+		if assert.True(found, "submission %d", id) {
+			assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+		}
+	}
+	assert.Equal(submitters*tasksPerSubmitter, count)
+
+	assert.Zero(disp.waitingTasks.len())
+	disp.JobStats.Lock()
+	assert.Zero(disp.JobStats.TasksInExecution)
+	disp.JobStats.Unlock()
+	for i, n := range disp.respChans.tasksWaitingOnChn {
+		assert.Zero(n, "tasks still counted on channel %d", i)
+	}
+}
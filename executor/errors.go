@@ -0,0 +1,41 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import "errors"
+
+// Errors returned by executors, the executor pool and the dispatcher so that
+// callers can branch on them with errors.Is.
+var (
+	// Executor queue is full and the rejection policy is to abort.
+	ErrQueueFull = errors.New("cannot submit, executor queue is full")
+
+	// No response channel is available for the task and the rejection
+	// policy is to abort.
+	ErrNoResponseChannel = errors.New("cannot submit, no response channel available")
+
+	// Submitted before the executor, pool or dispatcher is started.
+	ErrNotStarted = errors.New("cannot submit, not started")
+
+	// Submitted after the executor, pool or dispatcher is shut down.
+	ErrShutdown = errors.New("cannot submit, shut down")
+
+	// Task submitted is nil.
+	ErrInvalidTask = errors.New("invalid task")
+
+	// Another task with the same id is already in flight on the dispatcher.
+	ErrDuplicateTaskId = errors.New("cannot submit, a task with the same id is in flight")
+
+	// None of the tasks given to InvokeAny completed successfully.
+	ErrNoTaskSucceeded = errors.New("no task completed successfully")
+
+	// Returned, wrapped with details of the first failure, when a task of a
+	// Dag does not complete successfully.
+	ErrDagFailed = errors.New("dag execution failed")
+
+	// Returned, wrapped with the states involved, when a component is asked
+	// to make a transition its current state does not allow; like Start
+	// after Stop.
+	ErrIllegalStateTransition = errors.New("illegal lifecycle state transition")
+)
@@ -4,6 +4,7 @@
 package executor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gobuffalo/packr/v2"
@@ -16,6 +17,7 @@ type ExecutionService struct {
 	taskDispatcher  *Dispatcher
 	Monitor         *util.Monitor // exposed for testing purposes
 	ServiceCfgInUse *ExecServiceCfg
+	healthRules     *util.HealthRules
 }
 
 // Configuration for the entire execution service which comprises of
@@ -25,12 +27,25 @@ type ExecServiceCfg struct {
 	ExexPool   ExecPoolCfg   `json:"ExecPoolSettings"`
 	Executor   ExecCfg       `json:"ExecutorSettings"`
 	Monitoring MonitoringCfg `json:"MonitoringSettings"`
+	Scheduler  SchedulerCfg  `json:"SchedulerSettings"`
+	Cron       CronCfg       `json:"CronSettings"`
+	Retry      RetryPolicy   `json:"RetrySettings"` // default for all tasks
 }
 
 // Configuration about how the monitoring is done at runtime.
 type MonitoringCfg struct {
 	MonitoringFrequency int `json:"MonitoringFrequency"`
 	MonDataChanBufSz    int `json:"ChannelBufferSize"`
+
+	// Threshold rules on the health of the service, zero leaves a rule out.
+	// Queue depth is of all executors together and alerts when it stays
+	// above the threshold for the given seconds; rejection rate is per
+	// second; a task is stuck when its execution runs longer than the given
+	// seconds.
+	QueueDepthThreshold    int     `json:"QueueDepthThreshold"`
+	QueueDepthForSeconds   int     `json:"QueueDepthForSeconds"`
+	RejectionRateThreshold float64 `json:"RejectionRateThreshold"`
+	StuckTaskSeconds       int     `json:"StuckTaskSeconds"`
 }
 
 // Name of the Json element in any Json Configuration file which contains
@@ -135,12 +150,15 @@ func (es *ExecutionService) buildExecService() {
 	es.taskDispatcher = NewDispatcher(es.ServiceCfgInUse.Dispatcher,
 		NewExecutorPool(es.ServiceCfgInUse.ExexPool,
 			es.ServiceCfgInUse.Executor))
+	es.taskDispatcher.retryPolicy = &es.ServiceCfgInUse.Retry
 	util.Log(fmt.Sprintf("Started ExecutorService %v", es))
 
 	// start monitoring service
 	es.Monitor, _ = util.NewMonitor(es.ServiceCfgInUse.Monitoring.MonitoringFrequency,
 		es.ServiceCfgInUse.Monitoring.MonDataChanBufSz,
 		*es)
+	es.healthRules = es.ServiceCfgInUse.Monitoring.healthRules()
+	es.Monitor.SetHealthRules(es.healthRules)
 }
 
 func setupLogging() {
@@ -161,15 +179,80 @@ func setupLogging() {
 	// else if it configured, nothing to worry
 }
 
-func (es *ExecutionService) Start() {
-	es.taskDispatcher.Start()
+// Start the service. It can be started only once; starting it again, even
+// after it is stopped, returns ErrIllegalStateTransition.
+func (es *ExecutionService) Start() error {
+	if err := es.taskDispatcher.Start(); err != nil {
+		return err
+	}
 	es.Monitor.Start()
+	return nil
 }
 
 func (es *ExecutionService) Submit(tsk Task) (error, *Response) {
 	return es.taskDispatcher.Submit(tsk)
 }
 
+// Submit the task while honouring cancellation and deadline of the context.
+// See Dispatcher.SubmitContext for details.
+func (es *ExecutionService) SubmitContext(ctx context.Context, tsk Task) (error, *Response) {
+	return es.taskDispatcher.SubmitContext(ctx, tsk)
+}
+
+// Submit the task without waiting for its response, which can be collected
+// later through the returned Future. See Dispatcher.SubmitAsync for details.
+func (es *ExecutionService) SubmitAsync(ctx context.Context, tsk Task) (error, *Future) {
+	return es.taskDispatcher.SubmitAsync(ctx, tsk)
+}
+
+// Change the number of async and blocking executors at runtime. See
+// ExecutorPool.Resize for details.
+func (es *ExecutionService) Resize(async int, blocking int) error {
+	return es.taskDispatcher.execPool.Resize(async, blocking)
+}
+
+// Stop accepting tasks, but execute the ones already submitted. See
+// Dispatcher.Shutdown for details.
+func (es *ExecutionService) Shutdown() {
+	es.taskDispatcher.Shutdown()
+	es.Monitor.Stop()
+}
+
+// Stop accepting tasks and return the submitted ones which were never
+// started. See Dispatcher.ShutdownNow for details.
+func (es *ExecutionService) ShutdownNow() []Task {
+	dropped := es.taskDispatcher.ShutdownNow()
+	es.Monitor.Stop()
+	return dropped
+}
+
+// Wait until all tasks are done after a shutdown or the context is done, in
+// which case the context error is returned.
+func (es *ExecutionService) AwaitTermination(ctx context.Context) error {
+	return es.taskDispatcher.AwaitTermination(ctx)
+}
+
+func (es *ExecutionService) State() LifecycleState {
+	return es.taskDispatcher.State()
+}
+
+// Response of the submission with the given id. See Dispatcher.Lookup for
+// details.
+func (es *ExecutionService) Lookup(submissionId uint64) (*Response, bool) {
+	return es.taskDispatcher.Lookup(submissionId)
+}
+
+// What happened so far to the submission with the given id. See
+// Dispatcher.Status for details.
+func (es *ExecutionService) Status(submissionId uint64) (TaskInfo, bool) {
+	return es.taskDispatcher.Status(submissionId)
+}
+
+// Submissions queued or running at present, oldest first.
+func (es *ExecutionService) ListInFlight() []TaskInfo {
+	return es.taskDispatcher.ListInFlight()
+}
+
 func (es *ExecutionService) Stop() {
 	es.taskDispatcher.Stop()
 	es.Monitor.Stop()
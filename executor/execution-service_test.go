@@ -4,6 +4,8 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/umeshgeeta/goshared/util"
@@ -107,3 +109,477 @@ func TestExecutionServiceSubmissionFailure(t *testing.T) {
 	// we should get error here
 	assert.Errorf(err, "")
 }
+
+func TestExecutionServiceSubmitContextDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	// task runs for 200 ms while caller is willing to wait only 10 ms
+	task := NewBlockingTestTask(200000, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err, resp := es.SubmitContext(ctx, task)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.NotNil(resp)
+	assert.Equal(TaskStatusCancelled, resp.Status)
+
+	// the channel is released once the executor reports back, after
+	// that a regular submission should go through
+	task2 := NewBlockingTestTask(100, true)
+	err, resp = es.Submit(task2)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+}
+
+func TestExecutionServiceSubmitAsync(t *testing.T) {
+	assert := assert.New(t)
+
+	// even a blocking task returns immediately with a future
+	task := NewBlockingTestTask(20000, true)
+	err, f := es.SubmitAsync(context.Background(), task)
+	assert.Nil(err)
+	assert.NotNil(f)
+	assert.Equal(task.GetId(), f.TaskId())
+	err, resp := f.GetWithTimeout(time.Second)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.True(f.IsDone())
+	assert.Equal(TaskStatusCompletedSuccessfully, f.Get().Status)
+	assert.False(f.Cancel())
+
+	// cancelled future reports cancellation straight away
+	task2 := NewBlockingTestTask(200000, false)
+	err, f2 := es.SubmitAsync(context.Background(), task2)
+	assert.Nil(err)
+	assert.True(f2.Cancel())
+	<-f2.Done()
+	assert.True(f2.IsCancelled())
+	assert.Equal(TaskStatusCancelled, f2.Get().Status)
+}
+
+func TestExecutionServiceSubmitFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	err, tf := SubmitFunc(es, func(ctx context.Context) (int, error) {
+		return 42, nil
+	})
+	assert.Nil(err)
+	val, err := tf.Get()
+	assert.Nil(err)
+	assert.Equal(42, val)
+	assert.Equal("42", tf.Future.Get().Result)
+
+	failure := errors.New("no luck")
+	err, tf2 := SubmitFunc(es, func(ctx context.Context) (string, error) {
+		return "", failure
+	})
+	assert.Nil(err)
+	_, err = tf2.GetWithTimeout(time.Second)
+	assert.ErrorIs(err, failure)
+	assert.Equal(TaskStatusCompletedFailed, tf2.Future.Get().Status)
+}
+
+func TestExecutionServiceShutdown(t *testing.T) {
+	assert := assert.New(t)
+	testEs := createExecServiceWithTestCommonCfg(es)
+	assert.Nil(testEs.Start())
+
+	err, f := testEs.SubmitAsync(context.Background(), NewBlockingTestTask(10000, true))
+	assert.Nil(err)
+	testEs.Shutdown()
+	assert.Equal(StateShuttingDown, testEs.State())
+	err, _ = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.NotNil(err)
+
+	// submitted task completes before the service terminates
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(testEs.AwaitTermination(ctx))
+	assert.Equal(StateTerminated, testEs.State())
+	assert.True(f.IsDone())
+	assert.Equal(TaskStatusCompletedSuccessfully, f.Get().Status)
+	assert.ErrorIs(testEs.Start(), ErrIllegalStateTransition)
+}
+
+func TestExecutionServiceShutdownNow(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.ChannelCapacity = 2
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+
+	// first one keeps the only async executor busy, second one waits in queue
+	started := make(chan struct{})
+	release := make(chan struct{})
+	err, busy := testEs.SubmitAsync(context.Background(), NewProbeTestTask(false, func() {
+		close(started)
+		<-release
+	}))
+	assert.Nil(err)
+	<-started
+	queued := NewBlockingTestTask(10, false)
+	err, waiting := testEs.SubmitAsync(context.Background(), queued)
+	assert.Nil(err)
+
+	dropped := testEs.ShutdownNow()
+	close(release)
+	assert.Equal([]Task{queued}, dropped)
+	// whoever waits for the dropped task learns about the cancellation
+	assert.Equal(TaskStatusCancelled, waiting.Get().Status)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(testEs.AwaitTermination(ctx))
+	assert.Equal(TaskStatusCompletedSuccessfully, busy.Get().Status)
+}
+
+func TestExecutionServicePanickingTask(t *testing.T) {
+	assert := assert.New(t)
+	testEs := createExecServiceWithTestCommonCfg(es)
+	testEs.Start()
+	defer testEs.Stop()
+
+	err, resp := testEs.Submit(NewPanickingTestTask(true))
+	assert.Nil(err)
+	assert.Equal(TaskStatusPanicked, resp.Status)
+	stats := testEs.taskDispatcher.JobStats
+	assert.Eventually(func() bool {
+		stats.Lock()
+		defer stats.Unlock()
+		return stats.TasksPanicked == 1 && stats.TasksInExecution == 0
+	}, time.Second, time.Millisecond)
+
+	// blocking executor is still around
+	err, resp = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+}
+
+func TestExecutionServiceTaskTimeout(t *testing.T) {
+	assert := assert.New(t)
+	testEs := createExecServiceWithTestCommonCfg(es)
+	testEs.Start()
+	defer testEs.Stop()
+
+	err, resp := testEs.Submit(NewTimedTestTask(2000000, true, 5*time.Millisecond))
+	assert.Nil(err)
+	assert.Equal(TaskStatusTimedOut, resp.Status)
+	stats := testEs.taskDispatcher.JobStats
+	assert.Eventually(func() bool {
+		stats.Lock()
+		defer stats.Unlock()
+		return stats.TasksTimedOut == 1 && stats.TasksInExecution == 0
+	}, time.Second, time.Millisecond)
+
+	// the channel is released and the executor takes new work right away
+	err, resp = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+}
+
+func TestExecutionServiceRetry(t *testing.T) {
+	assert := assert.New(t)
+	testEs := createExecServiceWithTestCommonCfg(es)
+	testEs.Start()
+	defer testEs.Stop()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoffMs: 1, Multiplier: 2, Jitter: 0.5}
+	err, resp := testEs.Submit(NewFlakyTestTask(2, true, policy))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.Equal(3, resp.Attempts)
+	assert.Len(resp.Errors, 2)
+
+	// gives up after maximum attempts, errors of all attempts are reported
+	err, resp = testEs.Submit(NewFlakyTestTask(5, true, policy))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedFailed, resp.Status)
+	assert.Equal(3, resp.Attempts)
+	assert.Len(resp.Errors, 3)
+
+	// no retry if the predicate does not like the errors
+	picky := *policy
+	picky.RetryOn = func(errs []error) bool {
+		return false
+	}
+	err, resp = testEs.Submit(NewFlakyTestTask(1, true, &picky))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedFailed, resp.Status)
+	assert.Equal(1, resp.Attempts)
+
+	stats := testEs.taskDispatcher.JobStats
+	stats.Lock()
+	assert.Equal(4, stats.TaskRetries)
+	stats.Unlock()
+}
+
+func TestExecutionServiceRejection(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.WaitForChanAvail = false
+	testEs := cfg.MakeExecServiceFromCfg()
+	err, _ := testEs.Submit(NewBlockingTestTask(10, true))
+	assert.ErrorIs(err, ErrNotStarted)
+	testEs.Start()
+	defer testEs.Stop()
+
+	// the only channel is taken up by the first task
+	err, f := testEs.SubmitAsync(context.Background(), NewBlockingTestTask(20000, false))
+	assert.Nil(err)
+	err, _ = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.ErrorIs(err, ErrNoResponseChannel)
+	f.Get()
+
+	cfg = createCommonTestCfg(es)
+	cfg.Dispatcher.WaitForChanAvail = false
+	cfg.Dispatcher.RejectionPolicy = RejectCallerRuns
+	runsEs := cfg.MakeExecServiceFromCfg()
+	runsEs.Start()
+	defer runsEs.Stop()
+	err, f = runsEs.SubmitAsync(context.Background(), NewBlockingTestTask(20000, false))
+	assert.Nil(err)
+	task := NewBlockingTestTask(10, true)
+	err, resp := runsEs.Submit(task)
+	assert.Nil(err)
+	assert.Equal(task.GetId(), resp.TaskId)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.False(f.IsDone())
+	// the task ran after all, it is not a rejection
+	stats := taskStats(runsEs.GetData().Data)
+	assert.Equal(2, stats.TotalTasksSubmitted)
+	assert.Equal(1, stats.Completed.Blocking)
+	assert.Zero(stats.Rejected.Total())
+}
+
+func TestExecutionServiceExecutorCallerRuns(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.ChannelCapacity = 3
+	cfg.Executor.WaitForAvailability = false
+	cfg.Executor.RejectionPolicy = RejectCallerRuns
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	// the only async executor runs one task and has another one queued
+	release := make(chan struct{})
+	err, running := testEs.SubmitAsync(context.Background(), NewHeldTestTask(false, release))
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		info, ok := testEs.Status(running.SubmissionId())
+		return ok && info.State == TaskRunning
+	}, time.Second, time.Millisecond)
+	err, queued := testEs.SubmitAsync(context.Background(), NewHeldTestTask(false, release))
+	assert.Nil(err)
+
+	// so the next one is run by the submitter, it is counted before it runs
+	inExecution := -1
+	err, ran := testEs.SubmitAsync(context.Background(), NewProbeTestTask(false, func() {
+		testEs.taskDispatcher.JobStats.Lock()
+		inExecution = testEs.taskDispatcher.JobStats.TasksInExecution
+		testEs.taskDispatcher.JobStats.Unlock()
+	}))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, ran.Get().Status)
+	assert.Equal(3, inExecution)
+
+	close(release)
+	running.Get()
+	queued.Get()
+	assert.Eventually(func() bool {
+		stats := taskStats(testEs.GetData().Data)
+		return stats.TasksInExecution == 0 && stats.Completed.Async == 3
+	}, time.Second, time.Millisecond)
+	stats := taskStats(testEs.GetData().Data)
+	assert.Equal(3, stats.TotalTasksSubmitted)
+	assert.Zero(stats.Rejected.Total())
+}
+
+func TestExecutionServiceSubmittedNeverDecreases(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.ChannelCapacity = 3
+	cfg.Executor.WaitForAvailability = false
+	var testEs *ExecutionService
+	submitted := -1
+	cfg.Executor.RejectionHandler = func(tsk Task, reason error) error {
+		testEs.taskDispatcher.JobStats.Lock()
+		submitted = testEs.taskDispatcher.JobStats.TotalTasksSubmitted
+		testEs.taskDispatcher.JobStats.Unlock()
+		return reason
+	}
+	testEs = cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	// the only async executor runs one task and has another one queued
+	release := make(chan struct{})
+	err, running := testEs.SubmitAsync(context.Background(), NewHeldTestTask(false, release))
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		info, ok := testEs.Status(running.SubmissionId())
+		return ok && info.State == TaskRunning
+	}, time.Second, time.Millisecond)
+	err, queued := testEs.SubmitAsync(context.Background(), NewHeldTestTask(false, release))
+	assert.Nil(err)
+
+	// so the next one fails while being handed over, it is never counted
+	err, _ = testEs.SubmitAsync(context.Background(), NewBlockingTestTask(0, false))
+	assert.ErrorIs(err, ErrQueueFull)
+	assert.Equal(2, submitted)
+
+	close(release)
+	running.Get()
+	queued.Get()
+	assert.Eventually(func() bool {
+		stats := taskStats(testEs.GetData().Data)
+		return stats.TasksInExecution == 0 && stats.Completed.Async == 2
+	}, time.Second, time.Millisecond)
+	stats := taskStats(testEs.GetData().Data)
+	assert.Equal(2, stats.TotalTasksSubmitted)
+	assert.Equal(2, stats.AsyncTasksSubmitted)
+	assert.Equal(1, stats.Rejected.Async)
+}
+
+func TestExecutionServiceSubmissionIds(t *testing.T) {
+	assert := assert.New(t)
+
+	// async task is in flight for a while
+	slow := NewBlockingTestTask(100000, false)
+	err, resp := es.Submit(slow)
+	assert.Nil(err)
+	assert.Equal(TaskStatusSubmitted, resp.Status)
+	slowId := resp.SubmissionId
+	assert.NotZero(slowId)
+	found, ok := es.Lookup(slowId)
+	assert.True(ok)
+	assert.Equal(TaskStatusSubmitted, found.Status)
+	assert.Equal(slow.GetId(), found.TaskId)
+
+	// same task id cannot be submitted while the first one is in flight
+	dup := NewBlockingTestTask(100, true)
+	dup.id = slow.GetId()
+	err, _ = es.Submit(dup)
+	assert.ErrorIs(err, ErrDuplicateTaskId)
+
+	// blocking submissions get ids of their own
+	task := NewBlockingTestTask(100, true)
+	err, resp = es.Submit(task)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.Greater(resp.SubmissionId, slowId)
+	found, ok = es.Lookup(resp.SubmissionId)
+	assert.True(ok)
+	assert.Equal(TaskStatusCompletedSuccessfully, found.Status)
+
+	// once finished the slow task is remembered with its final status, and
+	// its id can be used again
+	assert.Eventually(func() bool {
+		found, ok = es.Lookup(slowId)
+		return ok && found.Status == TaskStatusCompletedSuccessfully
+	}, time.Second, 5*time.Millisecond)
+	err, f := es.SubmitAsync(context.Background(), dup)
+	assert.Nil(err)
+	assert.NotZero(f.SubmissionId())
+	assert.Equal(f.SubmissionId(), f.Get().SubmissionId)
+
+	_, ok = es.Lookup(0)
+	assert.False(ok)
+}
+
+func TestExecutionServiceResubmit(t *testing.T) {
+	assert := assert.New(t)
+	// the task id is free again as soon as the response is had
+	task := NewBlockingTestTask(0, true)
+	for i := 0; i < 100; i++ {
+		err, resp := es.Submit(task)
+		if !assert.Nil(err) {
+			return
+		}
+		assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	}
+	for i := 0; i < 100; i++ {
+		err, f := es.SubmitAsync(context.Background(), task)
+		if !assert.Nil(err) {
+			return
+		}
+		assert.Equal(TaskStatusCompletedSuccessfully, f.Get().Status)
+	}
+}
+
+func TestExecutionServiceStatus(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.ChannelCapacity = 2
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	// first one keeps the only async executor busy, second one waits in queue
+	err, busy := testEs.SubmitAsync(context.Background(), NewBlockingTestTask(50000, false))
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		info, _ := testEs.Status(busy.SubmissionId())
+		return info.State == TaskRunning
+	}, time.Second, time.Millisecond)
+	err, waiting := testEs.SubmitAsync(context.Background(), NewBlockingTestTask(10, false))
+	assert.Nil(err)
+
+	info, ok := testEs.Status(busy.SubmissionId())
+	assert.True(ok)
+	assert.Positive(info.Executor)
+	assert.Equal(1, info.Attempts)
+	assert.False(info.StartedAt.Before(info.SubmittedAt))
+	assert.Nil(info.Response)
+	info, ok = testEs.Status(waiting.SubmissionId())
+	assert.True(ok)
+	assert.Equal(TaskQueued, info.State)
+	assert.Equal(-1, info.Executor)
+	assert.True(info.StartedAt.IsZero())
+
+	inFlight := testEs.ListInFlight()
+	if assert.Len(inFlight, 2) {
+		assert.Equal(busy.SubmissionId(), inFlight[0].SubmissionId)
+		assert.Equal(waiting.SubmissionId(), inFlight[1].SubmissionId)
+	}
+
+	waiting.Get()
+	info, ok = testEs.Status(waiting.SubmissionId())
+	assert.True(ok)
+	assert.Equal(TaskCompleted, info.State)
+	assert.True(info.State.IsFinal())
+	assert.False(info.EndedAt.Before(info.StartedAt))
+	if assert.NotNil(info.Response) {
+		assert.Equal(TaskStatusCompletedSuccessfully, info.Response.Status)
+	}
+	assert.Empty(testEs.ListInFlight())
+}
+
+func TestExecutionServiceTaskMetrics(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	for i := 0; i < 3; i++ {
+		err, resp := testEs.Submit(NewBlockingTestTask(2000, true))
+		assert.Nil(err)
+		assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	}
+	err, f := testEs.SubmitAsync(context.Background(), NewPanickingTestTask(false))
+	assert.Nil(err)
+	f.Get()
+
+	var stats *TaskStats
+	assert.Eventually(func() bool {
+		stats = taskStats(testEs.GetData().Data)
+		return stats.TasksInExecution == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(KindCounts{Blocking: 3}, stats.Completed)
+	assert.Equal(KindCounts{Async: 1}, stats.Failed)
+	assert.Equal(int64(4), stats.Execution.Count)
+	assert.Equal(int64(4), stats.QueueWait.Count)
+	assert.GreaterOrEqual(stats.Execution.MaxMs, 2.0)
+	assert.Greater(stats.Execution.P99Ms, 0.0)
+	assert.NotEmpty(stats.ExecutorUtilization)
+}
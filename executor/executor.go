@@ -21,25 +21,46 @@
 package executor
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/umeshgeeta/goshared/util"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // We start with core Executor contract as an interface. As expected it has
 // common methods like Start, Stop and Submit to receive a task. User can also
 // specify whether we wait for availability of an internal buffer to accept the
-// incoming task.
+// incoming task. An executor goes through the lifecycle states New, Running,
+// ShuttingDown and Terminated; it cannot be started again once shut down.
 type Executor interface {
-	Start()
+	Start() error
 
 	Submit(t Task) error
 
+	// Same as Submit, but waiting for space in the queue is abandoned when
+	// the context is done. A task still in the queue when the context is done
+	// is not executed; a cancelled response is reported back instead.
+	SubmitContext(ctx context.Context, t Task) error
+
 	HowManyInQueue() int
 
 	WaitForAvailability(wfa bool)
 
+	// Stop accepting tasks, the ones already queued are still executed.
+	Shutdown()
+
+	// Stop accepting tasks and return the queued ones which were never
+	// started; a task in execution is allowed to finish.
+	ShutdownNow() []Task
+
+	// Wait until the executor is terminated after a shutdown or the context
+	// is done, in which case the context error is returned.
+	AwaitTermination(ctx context.Context) error
+
+	State() LifecycleState
+
+	// Same as ShutdownNow, but tasks never started are simply dropped.
 	Stop()
 }
 
@@ -47,7 +68,9 @@ type Executor interface {
 type ExecCfg struct {
 
 	// How many maximum number tasks accepted by the executor when it is
-	// already executing a task. These tasks will form the queue.
+	// already executing a task. These tasks will form the queue. Zero, or
+	// less, is taken as one so that a task can be handed over to the
+	// executor at all.
 	TaskQueueCapacity int `json:"task_queue_capacity"`
 
 	// If true, despite the full task queue capacity, caller invoking
@@ -55,49 +78,95 @@ type ExecCfg struct {
 	// false. So once the task queue is full, subsequent attempts to add a task
 	// will fail as long as the queue if filled.
 	WaitForAvailability bool `json:"wait_for_availability"`
+
+	// Every this many milliseconds a task waiting in the queue gains one
+	// priority level, so that low priority tasks still make progress while
+	// higher priority tasks keep arriving. Zero disables aging.
+	PriorityAgingMs int `json:"priority_aging_ms"`
+
+	// Default upper limit, in milliseconds, on how long a task can execute;
+	// tasks implementing TimedTask set their own. Zero means no limit.
+	TaskTimeoutMs int `json:"task_timeout_ms"`
+
+	// What to do with a task when the queue is full and we are not waiting
+	// for availability. Empty means RejectAbort.
+	RejectionPolicy RejectionPolicy `json:"rejection_policy"`
+
+	// Overrides the rejection policy if set, only programmatically.
+	RejectionHandler RejectionHandler `json:"-"`
+
+	// Invoked when a task panics; the executor recovers the panic regardless
+	// and reports a response of status TaskStatusPanicked. Optional and can
+	// only be set programmatically.
+	PanicHandler PanicHandler `json:"-"`
+
+	// Wraps the execution of every task, the first one being the outermost.
+	// Optional and can only be set programmatically.
+	Middleware []Middleware `json:"-"`
 }
 
 // We model thread struct as a standard executor. It is a frugal attempt to
 // model Java thread Object. The run method on this struct, a private method,
 // so outside modules cannot call it directly; is basically an infinite loop
-// of either waiting for a task or executing until the flag is turned off by
-// the Stop method. All submitted tasks are funneled through a channel so
-// 'waiting' for a task happens naturally.
+// of either waiting for a task or executing until the queue is closed by
+// one of the shutdown methods. All submitted tasks are funneled through a priority queue
+// so that higher priority tasks are served first and 'waiting' for a task
+// happens in the queue.
 type thread struct {
-	continueRun bool
+	id int // unique within the process
+	lc *lifecycle
 
-	// Current design choice is one channel per thread. We could change it
-	// to use only 2 channels shared among all executors, one for blocking
+	// Current design choice is one queue per thread. We could change it
+	// to use only 2 queues shared among all executors, one for blocking
 	// and another for non-blocking tasks.
-	taskQueue           chan Task // incoming tasks on a channel
+	taskQueue           *taskQueue // incoming tasks
 	queueCapacity       int
+	priorityAging       time.Duration
 	waitForAvailability bool
-	mux                 sync.Mutex
+	panicHandler        PanicHandler
+	handler             Handler // task invocation wrapped in the middleware
+	rejectionPolicy     RejectionPolicy
+	rejectionHandler    RejectionHandler
+	taskTimeout         time.Duration  // default, zero means no limit
+	group               *executorGroup // siblings to steal work from, if enabled
+	lastActive          int64          // unix nano time when the thread last finished a task
+	executing           int32          // 1 while a task is being executed
+	onEvent             func(ev taskEvent, tsk Task, executor int, resp *Response)
 }
 
-// Start the thread. We expect that callers would not call Start after having
-// already called Stop. The pattern assumed is create new thread, start and
-// stop. Multiple Starts and Stops are not supported at present.
-func (t *thread) Start() {
-	// First, create the channel which will queue the incoming tasks
-	t.taskQueue = make(chan Task, t.queueCapacity)
-	// Set the flag so as we continue to process the incoming tasks
-	t.continueRun = true
+// Last executor id handed out.
+var lastExecutorId int32
+
+// Start the thread. A thread can be started only once; starting it again or
+// after it was shut down is an error.
+func (t *thread) Start() error {
+	if err := t.lc.start(); err != nil {
+		return err
+	}
 	// do all that task execution in a different thread and
 	// do not occupy the calling thread
 	go t.run()
+	return nil
 }
 
 func (t *thread) run() {
-	for t.continueRun {
-		tsk := <-t.taskQueue
-		if tsk != nil {
+	// run loop exits only when the queue is closed or drained after shutdown
+	defer t.lc.terminate()
+	for {
+		tsk, ok := t.nextTask()
+		if ok {
 			rspChan := tsk.GetRespChan()
 			if rspChan != nil {
-				resp := tsk.Execute()
+				atomic.StoreInt32(&t.executing, 1)
+				t.notify(taskDequeued, tsk, nil)
+				t.notify(taskStarted, tsk, nil)
+				resp := t.execute(tsk)
+				atomic.StoreInt32(&t.executing, 0)
+				atomic.StoreInt64(&t.lastActive, time.Now().UnixNano())
 				// set the task is in response since we do not know
 				// whether the task implementation may or many have set
 				resp.TaskId = tsk.GetId()
+				t.notify(taskEnded, tsk, &resp)
 				rspChan <- resp
 				util.LogDebug(fmt.Sprintf("Responded back for task %d", tsk.GetId()))
 			} else {
@@ -108,41 +177,111 @@ func (t *thread) run() {
 				fmt.Printf("Tasks %d has no channel to report back response.\n", tsk.GetId())
 			}
 		} else {
-			fmt.Printf("Read nil task on the channel, channel probably closed.")
+			util.LogDebug(fmt.Sprintf("Task queue of executor %d is closed", t.id))
+			break
 		}
 	}
 	fmt.Println("Exiting run")
 }
 
+func (t *thread) notify(ev taskEvent, tsk Task, resp *Response) {
+	if t.onEvent != nil {
+		t.onEvent(ev, tsk, t.id, resp)
+	}
+}
+
+// Next task to execute, waiting for one if needed. Returns false when the
+// queue is closed.
+func (t *thread) nextTask() (Task, bool) {
+	if t.group != nil {
+		return t.group.next(t)
+	}
+	return t.taskQueue.take()
+}
+
 func (t *thread) Submit(tsk Task) error {
-	if !t.continueRun {
-		return errors.New("executor is not started")
+	return t.SubmitContext(context.Background(), tsk)
+}
+
+func (t *thread) SubmitContext(ctx context.Context, tsk Task) error {
+	switch t.lc.get() {
+	case StateNew:
+		return ErrNotStarted
+	case StateShuttingDown, StateTerminated:
+		return ErrShutdown
 	}
-	var err error = nil
-	if t.waitForAvailability {
-		// channel blocks naturally until the capacity is made available
-		t.taskQueue <- tsk
-	} else {
-		t.mux.Lock()
-		if t.HowManyInQueue() < t.queueCapacity {
-			t.taskQueue <- tsk
-		} else {
-			err = errors.New("cannot submit, executor already has accepted maximum number of tasks")
-		}
-		t.mux.Unlock()
+	if ctx != context.Background() {
+		// only contexts which can be cancelled or carry values, say put by
+		// a submit middleware, are worth carrying to the executor
+		tsk = &contextTask{Task: tsk, ctx: ctx}
+	}
+	// queue blocks until the capacity is made available or the caller gives
+	// up, provided we are to wait for availability
+	added, err := t.taskQueue.put(ctx, tsk, t.waitForAvailability)
+	if err == nil && !added {
+		err = t.reject(ctx, tsk)
+	}
+	if err == nil {
+		util.LogDebug(fmt.Sprintf("Submitted task %d successfully", tsk.GetId()))
 	}
-	fmt.Printf("Submitted task %d successfully\n", tsk.GetId())
 	return err
 }
 
+// Stop accepting tasks, but finish the ones already queued before the run
+// loop exits.
+func (t *thread) Shutdown() {
+	switch t.lc.shutdown() {
+	case StateRunning:
+		t.taskQueue.drain()
+	case StateNew:
+		// never started; there is no run loop to drain the queue
+		t.taskQueue.close()
+	}
+}
+
+// Close the queue, the run loop exits after the task in execution if any.
+// Queued tasks are returned to the caller, unwrapped from any internal
+// wrapping so that they are the very tasks submitted.
+func (t *thread) ShutdownNow() []Task {
+	t.lc.shutdown()
+	dropped := t.taskQueue.close()
+	for i, tsk := range dropped {
+		dropped[i] = unwrapTask(tsk)
+	}
+	return dropped
+}
+
+func (t *thread) AwaitTermination(ctx context.Context) error {
+	return t.lc.await(ctx)
+}
+
+func (t *thread) State() LifecycleState {
+	return t.lc.get()
+}
+
 func (t *thread) Stop() {
-	t.continueRun = false
-	// also close the queue channel so no more tasks are accepted
-	close(t.taskQueue)
+	t.ShutdownNow()
+}
+
+// Leave the work stealing group, if any, and shut down gracefully. Used when
+// the pool shrinks.
+func (t *thread) retire() {
+	if t.group != nil {
+		t.group.leave(t)
+	}
+	t.Shutdown()
+}
+
+// How long the thread has been without any task; zero if it is busy.
+func (t *thread) idleFor() time.Duration {
+	if atomic.LoadInt32(&t.executing) == 1 || t.taskQueue.len() > 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.lastActive)))
 }
 
 func (t *thread) HowManyInQueue() int {
-	return len(t.taskQueue)
+	return t.taskQueue.len()
 }
 
 func (t *thread) WaitForAvailability(wfa bool) {
@@ -150,15 +289,27 @@ func (t *thread) WaitForAvailability(wfa bool) {
 }
 
 func NewExecutor(cfg ExecCfg) Executor {
-	// We start a thread with 'continueRun' as false so that the caller needs to explicitly
-	// invoke Start on the thread where queue capacity is built and any other initialization.
+	// We start a thread in the New state so that the caller needs to explicitly
+	// invoke Start on the thread before it accepts any task.
 	t := new(thread)
+	t.id = int(atomic.AddInt32(&lastExecutorId, 1))
+	t.lc = newLifecycle()
 	t.waitForAvailability = cfg.WaitForAvailability
-	t.mux = sync.Mutex{}
 	t.queueCapacity = cfg.TaskQueueCapacity
+	if t.queueCapacity < 1 {
+		t.queueCapacity = 1
+	}
+	t.priorityAging = time.Duration(cfg.PriorityAgingMs) * time.Millisecond
+	t.panicHandler = cfg.PanicHandler
+	t.handler = Chain(invokeTask, cfg.Middleware...)
+	t.rejectionPolicy = cfg.RejectionPolicy
+	t.rejectionHandler = cfg.RejectionHandler
+	t.taskTimeout = time.Duration(cfg.TaskTimeoutMs) * time.Millisecond
+	t.taskQueue = newTaskQueue(t.queueCapacity, t.priorityAging)
+	t.lastActive = time.Now().UnixNano()
 	return t
 }
 
 func (t *thread) IsRunning() bool {
-	return t.continueRun
+	return t.lc.isRunning()
 }
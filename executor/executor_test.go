@@ -4,10 +4,14 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestExecutorFailSubmission(t *testing.T) {
@@ -73,3 +77,492 @@ func waitForResponse(ch chan Response, t *testing.T, ts int, msg string, wg *syn
 	assert.Equal(rsp.Status, ts, msg)
 	fmt.Println("waitForResponse Done")
 }
+
+func TestExecutorZeroQueueCapacity(t *testing.T) {
+	assert := assert.New(t)
+	for _, wait := range []bool{false, true} {
+		thread := NewExecutor(ExecCfg{TaskQueueCapacity: 0, WaitForAvailability: wait})
+		thread.Start()
+		ch := make(chan Response, 2)
+		for i := 0; i < 2; i++ {
+			task := NewTestTask(10)
+			task.SetRespChan(ch)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if assert.Nil(thread.SubmitContext(ctx, task)) {
+				assert.Equal(TaskStatusCompletedSuccessfully, (<-ch).Status)
+			}
+			cancel()
+		}
+		thread.Stop()
+	}
+}
+
+func TestExecutorSubmitContextCancelled(t *testing.T) {
+	assert := assert.New(t)
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   1,
+		WaitForAvailability: true,
+	}
+	thread := NewExecutor(*execCfg)
+	thread.Start()
+	defer thread.Stop()
+
+	// first task keeps the executor busy, second one fills up the queue
+	ch := make(chan Response, 3)
+	for i := 0; i < 2; i++ {
+		task := NewBlockingTestTask(50000, false)
+		task.SetRespChan(ch)
+		assert.Nil(thread.Submit(task))
+	}
+
+	// third one cannot find space in the queue before the deadline
+	task := NewBlockingTestTask(10, false)
+	task.SetRespChan(ch)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(thread.SubmitContext(ctx, task), context.DeadlineExceeded)
+}
+
+func TestExecutorPriority(t *testing.T) {
+	assert := assert.New(t)
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   3,
+		WaitForAvailability: false,
+	}
+	thread := NewExecutor(*execCfg)
+	thread.Start()
+	defer thread.Stop()
+
+	ch := make(chan Response, 4)
+	// keeps the executor busy while others line up in the queue
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busy := NewProbeTestTask(false, func() {
+		close(started)
+		<-release
+	})
+	busy.SetRespChan(ch)
+	assert.Nil(thread.Submit(busy))
+	<-started
+
+	low := NewPrioritizedTestTask(10, false, -1)
+	high := NewPrioritizedTestTask(10, false, 10)
+	mid := NewBlockingTestTask(10, false) // default priority in between
+	for _, tsk := range []Task{low, high, mid} {
+		tsk.SetRespChan(ch)
+		assert.Nil(thread.Submit(tsk))
+	}
+	close(release)
+
+	order := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		order = append(order, (<-ch).TaskId)
+	}
+	assert.Equal([]int{busy.GetId(), high.GetId(), mid.GetId(), low.GetId()}, order)
+}
+
+func TestTaskQueueAging(t *testing.T) {
+	assert := assert.New(t)
+	q := newTaskQueue(2, time.Millisecond)
+	low := NewPrioritizedTestTask(10, false, 0)
+	added, err := q.put(context.Background(), low, false)
+	assert.True(added)
+	assert.Nil(err)
+	// low priority task gains more than 2 levels while waiting
+	time.Sleep(5 * time.Millisecond)
+	high := NewPrioritizedTestTask(10, false, 2)
+	q.put(context.Background(), high, false)
+	// queue is full now
+	added, err = q.put(context.Background(), NewTestTask(10), false)
+	assert.False(added)
+	assert.Nil(err)
+
+	first, _ := q.take()
+	assert.Equal(low.GetId(), first.GetId())
+	second, _ := q.take()
+	assert.Equal(high.GetId(), second.GetId())
+
+	q.close()
+	_, ok := q.take()
+	assert.False(ok)
+}
+
+func TestExecutorPoolWorkStealing(t *testing.T) {
+	assert := assert.New(t)
+	pool := NewExecutorPool(ExecPoolCfg{AsyncTaskExecutorCount: 2, BlockingTaskExecutorCount: 1, WorkStealing: true},
+		ExecCfg{TaskQueueCapacity: 4})
+	pool.stats = newTaskStats()
+	pool.Start()
+	defer pool.Stop()
+
+	// every task is pinned to the first executor while the second one idles
+	ch := make(chan Response, 4)
+	busy := NewBlockingTestTask(50000, false)
+	busy.SetRespChan(ch)
+	assert.Nil(pool.asyncExecutors[0].Submit(busy))
+	for i := 0; i < 3; i++ {
+		tsk := NewBlockingTestTask(10, false)
+		tsk.SetRespChan(ch)
+		assert.Nil(pool.asyncExecutors[0].Submit(tsk))
+	}
+
+	// short tasks are done by the idle sibling well before the busy one is
+	order := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		order = append(order, (<-ch).TaskId)
+	}
+	assert.Equal(busy.GetId(), order[3])
+	assert.GreaterOrEqual(pool.stats.TasksStolen, 1)
+	assert.Equal(pool.stats.TasksStolen, pool.stats.AsyncTasksStolen)
+	assert.Equal(0, pool.stats.BlockingTasksStolen)
+}
+
+func TestExecutorPoolResize(t *testing.T) {
+	assert := assert.New(t)
+	pool := NewExecutorPool(ExecPoolCfg{AsyncTaskExecutorCount: 1, BlockingTaskExecutorCount: 1},
+		ExecCfg{TaskQueueCapacity: 2, WaitForAvailability: true})
+	pool.Start()
+	defer pool.Stop()
+
+	assert.NotNil(pool.Resize(0, 1))
+	assert.Nil(pool.Resize(3, 2))
+	async, blocking := pool.Size()
+	assert.Equal(3, async)
+	assert.Equal(2, blocking)
+
+	ch := make(chan Response, 9)
+	for i := 0; i < 9; i++ {
+		tsk := NewBlockingTestTask(5000, false)
+		tsk.SetRespChan(ch)
+		assert.Nil(pool.Submit(tsk))
+	}
+	// retired executors finish what is queued on them
+	assert.Nil(pool.Resize(1, 1))
+	assert.Equal(2, pool.TotalExecutorCount())
+	for i := 0; i < 9; i++ {
+		select {
+		case rsp := <-ch:
+			assert.Equal(TaskStatusCompletedSuccessfully, rsp.Status)
+		case <-time.After(time.Second):
+			t.Fatalf("task response %d did not arrive", i)
+		}
+	}
+}
+
+func TestExecutorPoolAutoscaling(t *testing.T) {
+	assert := assert.New(t)
+	pool := NewExecutorPool(ExecPoolCfg{AsyncTaskExecutorCount: 1, BlockingTaskExecutorCount: 1,
+		Autoscaling: AutoscalingCfg{
+			Enabled:                   true,
+			MaxAsyncTaskExecutorCount: 3,
+			ScaleUpQueueDepth:         1,
+			KeepAliveMs:               20,
+			CheckIntervalMs:           2,
+		}}, ExecCfg{TaskQueueCapacity: 8, WaitForAvailability: true})
+	pool.Start()
+	defer pool.Stop()
+
+	ch := make(chan Response, 8)
+	for i := 0; i < 8; i++ {
+		tsk := NewBlockingTestTask(10000, false)
+		tsk.SetRespChan(ch)
+		assert.Nil(pool.Submit(tsk))
+	}
+	waitForSize := func(expected int) int {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if async, _ := pool.Size(); async == expected {
+				return async
+			}
+			time.Sleep(time.Millisecond)
+		}
+		async, _ := pool.Size()
+		return async
+	}
+	// grows up to the maximum while tasks are queued up
+	assert.Equal(3, waitForSize(3))
+	for i := 0; i < 8; i++ {
+		<-ch
+	}
+	// and shrinks back to the core once idle
+	assert.Equal(1, waitForSize(1))
+}
+
+func TestExecutorPoolAutoscalingRetiredBusy(t *testing.T) {
+	assert := assert.New(t)
+	pool := NewExecutorPool(ExecPoolCfg{AsyncTaskExecutorCount: 1, BlockingTaskExecutorCount: 1,
+		Autoscaling: AutoscalingCfg{
+			Enabled:                   true,
+			MaxAsyncTaskExecutorCount: 2,
+			KeepAliveMs:               1,
+			CheckIntervalMs:           3600000,
+		}}, ExecCfg{TaskQueueCapacity: 1, WaitForAvailability: true})
+	pool.Start()
+	defer pool.Stop()
+	// grows by one while a task is queued up behind a busy one
+	ch := make(chan Response, 2)
+	busyStarted := make(chan struct{})
+	busyRelease := make(chan struct{})
+	busy := NewProbeTestTask(false, func() {
+		close(busyStarted)
+		<-busyRelease
+	})
+	busy.SetRespChan(ch)
+	assert.Nil(pool.Submit(busy))
+	<-busyStarted
+	queued := NewBlockingTestTask(0, false)
+	queued.SetRespChan(ch)
+	assert.Nil(pool.Submit(queued))
+	pool.scaler.evaluate()
+	if async, _ := pool.Size(); !assert.Equal(2, async) {
+		return
+	}
+	close(busyRelease)
+	<-ch
+	<-ch
+
+	// a task reaches the extra executor right after it is found idle
+	pool.mux.RLock()
+	extra := pool.asyncExecutors[1].(*thread)
+	pool.mux.RUnlock()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tsk := NewProbeTestTask(false, func() {
+		close(started)
+		<-release
+	})
+	tsk.SetRespChan(make(chan Response, 1))
+	assert.Nil(extra.Submit(tsk))
+	<-started
+	atomic.StoreInt32(&extra.executing, 0)
+	atomic.StoreInt64(&extra.lastActive, time.Now().Add(-time.Second).UnixNano())
+	pool.scaler.evaluate()
+	async, _ := pool.Size()
+	assert.Equal(1, async)
+
+	// the pool terminates only once the retired executor is done
+	pool.ShutdownNow()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(pool.AwaitTermination(ctx), context.DeadlineExceeded)
+	close(release)
+	assert.Nil(pool.AwaitTermination(context.Background()))
+	assert.Equal(StateTerminated, extra.State())
+}
+
+func TestExecutorShutdown(t *testing.T) {
+	assert := assert.New(t)
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   3,
+		WaitForAvailability: false,
+	}
+	thread := NewExecutor(*execCfg)
+	assert.Equal(StateNew, thread.State())
+	assert.Nil(thread.Start())
+	assert.Equal(StateRunning, thread.State())
+
+	ch := make(chan Response, 3)
+	for i := 0; i < 3; i++ {
+		task := NewBlockingTestTask(5000, false)
+		task.SetRespChan(ch)
+		assert.Nil(thread.Submit(task))
+	}
+	thread.Shutdown()
+	assert.NotNil(thread.Submit(NewTestTask(10)))
+
+	// queued tasks are still executed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(thread.AwaitTermination(ctx))
+	assert.Equal(StateTerminated, thread.State())
+	assert.Equal(3, len(ch))
+
+	// cannot be started again
+	assert.ErrorIs(thread.Start(), ErrIllegalStateTransition)
+}
+
+func TestExecutorShutdownNow(t *testing.T) {
+	assert := assert.New(t)
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   2,
+		WaitForAvailability: false,
+	}
+	thread := NewExecutor(*execCfg)
+	thread.Start()
+
+	ch := make(chan Response, 3)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	busy := NewProbeTestTask(false, func() {
+		close(started)
+		<-release
+	})
+	busy.SetRespChan(ch)
+	assert.Nil(thread.Submit(busy))
+	<-started
+	queued := []*TestTask{NewBlockingTestTask(10, false), NewBlockingTestTask(10, false)}
+	for _, task := range queued {
+		task.SetRespChan(ch)
+		// a cancellable context makes the executor wrap the task internally
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		assert.Nil(thread.SubmitContext(ctx, task))
+	}
+
+	// task in execution finishes, the queued ones are handed back as is
+	dropped := thread.ShutdownNow()
+	close(release)
+	assert.ElementsMatch([]Task{queued[0], queued[1]}, dropped)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(thread.AwaitTermination(ctx))
+	assert.Equal(1, len(ch))
+
+	// shutting down a never started executor terminates it right away
+	idle := NewExecutor(*execCfg)
+	idle.Shutdown()
+	assert.Equal(StateTerminated, idle.State())
+	assert.ErrorIs(idle.Start(), ErrIllegalStateTransition)
+}
+
+func TestExecutorPanicRecovery(t *testing.T) {
+	assert := assert.New(t)
+	var handled []Task
+	var mux sync.Mutex
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   2,
+		WaitForAvailability: false,
+		PanicHandler: func(tsk Task, value any, stack []byte) {
+			mux.Lock()
+			handled = append(handled, tsk)
+			mux.Unlock()
+		},
+	}
+	thread := NewExecutor(*execCfg)
+	thread.Start()
+	defer thread.Stop()
+
+	ch := make(chan Response, 2)
+	bad := NewPanickingTestTask(false)
+	bad.SetRespChan(ch)
+	assert.Nil(thread.Submit(bad))
+	resp := <-ch
+	assert.Equal(TaskStatusPanicked, resp.Status)
+	assert.Equal(bad.GetId(), resp.TaskId)
+	assert.Len(resp.Errors, 1)
+	var pe *PanicError
+	assert.ErrorAs(resp.Errors[0], &pe)
+	assert.Equal(fmt.Sprintf("task %d cannot go on", bad.GetId()), pe.Value)
+	assert.NotEmpty(pe.Stack)
+	mux.Lock()
+	assert.Equal([]Task{bad}, handled)
+	mux.Unlock()
+
+	// panic(nil) is a panic all the same
+	nilPanic := NewNilPanickingTestTask(false)
+	nilPanic.SetRespChan(ch)
+	assert.Nil(thread.Submit(nilPanic))
+	resp = <-ch
+	assert.Equal(TaskStatusPanicked, resp.Status)
+	assert.Equal(nilPanic.GetId(), resp.TaskId)
+	mux.Lock()
+	assert.Equal([]Task{bad, nilPanic}, handled)
+	mux.Unlock()
+
+	// executor lives on
+	good := NewTestTask(10)
+	good.SetRespChan(ch)
+	assert.Nil(thread.Submit(good))
+	assert.Equal(TaskStatusCompletedSuccessfully, (<-ch).Status)
+}
+
+func TestExecutorTaskTimeout(t *testing.T) {
+	assert := assert.New(t)
+	execCfg := &ExecCfg{
+		TaskQueueCapacity:   2,
+		WaitForAvailability: false,
+		TaskTimeoutMs:       10,
+	}
+	thread := NewExecutor(*execCfg)
+	thread.Start()
+	defer thread.Stop()
+
+	// hangs way beyond the default timeout
+	ch := make(chan Response, 2)
+	hung := NewBlockingTestTask(2000000, false)
+	hung.SetRespChan(ch)
+	start := time.Now()
+	assert.Nil(thread.Submit(hung))
+	// a task with a timeout of its own is not bound by the default
+	slow := NewTimedTestTask(30000, false, time.Second)
+	slow.SetRespChan(ch)
+	assert.Nil(thread.Submit(slow))
+
+	resp := <-ch
+	assert.Equal(hung.GetId(), resp.TaskId)
+	assert.Equal(TaskStatusTimedOut, resp.Status)
+	assert.ErrorIs(resp.Errors[0], context.DeadlineExceeded)
+	resp = <-ch
+	assert.Equal(slow.GetId(), resp.TaskId)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.Less(time.Since(start), time.Second)
+}
+
+func TestExecutorRejectionPolicies(t *testing.T) {
+	assert := assert.New(t)
+	custom := errors.New("not today")
+	policies := []RejectionPolicy{RejectAbort, RejectCallerRuns, RejectDiscardOldest, RejectDiscard, ""}
+	for _, policy := range policies {
+		execCfg := &ExecCfg{
+			TaskQueueCapacity:   1,
+			WaitForAvailability: false,
+			RejectionPolicy:     policy,
+		}
+		if policy == "" {
+			execCfg.RejectionHandler = func(tsk Task, reason error) error {
+				assert.ErrorIs(reason, ErrQueueFull)
+				return custom
+			}
+		}
+		thread := NewExecutor(*execCfg)
+		thread.Start()
+
+		// first one keeps the executor busy, second one fills up the queue
+		ch := make(chan Response, 4)
+		busy := NewBlockingTestTask(20000, false)
+		busy.SetRespChan(ch)
+		assert.Nil(thread.Submit(busy))
+		time.Sleep(time.Millisecond)
+		queued := NewBlockingTestTask(10, false)
+		queued.SetRespChan(ch)
+		assert.Nil(thread.Submit(queued))
+		task := NewBlockingTestTask(10, false)
+		task.SetRespChan(ch)
+		err := thread.Submit(task)
+
+		switch policy {
+		case RejectAbort:
+			assert.ErrorIs(err, ErrQueueFull)
+		case RejectCallerRuns:
+			// executed before Submit returned
+			assert.Nil(err)
+			resp := <-ch
+			assert.Equal(task.GetId(), resp.TaskId)
+			assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+		case RejectDiscardOldest:
+			assert.Nil(err)
+			resp := <-ch
+			assert.Equal(queued.GetId(), resp.TaskId)
+			assert.Equal(TaskStatusDiscarded, resp.Status)
+			assert.Equal(1, thread.HowManyInQueue())
+		case RejectDiscard:
+			assert.Nil(err)
+			resp := <-ch
+			assert.Equal(task.GetId(), resp.TaskId)
+			assert.Equal(TaskStatusDiscarded, resp.Status)
+		default:
+			assert.ErrorIs(err, custom)
+		}
+		thread.Stop()
+	}
+}
@@ -2,13 +2,35 @@
 // Author: Umesh Patil, Neosemantix, Inc.
 package executor
 
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
 // Holds two separate arrays of executors - one for blocking tasks and
 // the other for async execution.
 // ExecutorPool also fulfills the actual Executor contract:
 // Start, Stop, Submit and other methods. That makes it consistent.
+//
+// The pool can be resized at runtime; executors retired while shrinking stop
+// accepting tasks but finish whatever is already queued on them.
+//
+// The pool is terminated once all of its executors, including the retired
+// ones, are terminated after a shutdown.
 type ExecutorPool struct {
+	mux               sync.RWMutex
 	asyncExecutors    []Executor
 	blockingExecutors []Executor
+	asyncGroup        *executorGroup // nil unless work stealing is on
+	blockingGroup     *executorGroup // nil unless work stealing is on
+	poolCfg           ExecPoolCfg
+	execCfg           ExecCfg
+	lc                *lifecycle
+	retired           []Executor // retired executors yet to terminate
+	scaler            *autoscaler
+	stats             *TaskStats                                                 // set by the dispatcher, steals are reported here
+	observer          func(ev taskEvent, tsk Task, executor int, resp *Response) // set by the dispatcher
 }
 
 type ExecPoolCfg struct {
@@ -19,6 +41,13 @@ type ExecPoolCfg struct {
 	// Number of executors which will be used to hand blocking task,
 	// caller is waiting for the execution result.
 	BlockingTaskExecutorCount int `json:"blocking_task_executor_count"`
+
+	// If true, an executor which has no task of its own takes a queued task
+	// from the busiest sibling executor of the same kind (async or blocking).
+	WorkStealing bool `json:"work_stealing"`
+
+	// Autoscaling settings, the above executor counts act as core counts.
+	Autoscaling AutoscalingCfg `json:"autoscaling"`
 }
 
 // async: how many executors for execution of async tasks
@@ -26,50 +55,203 @@ type ExecPoolCfg struct {
 // wfa: wait for availability in the queue for an executor
 func NewExecutorPool(epCfg ExecPoolCfg, cfg ExecCfg) *ExecutorPool {
 	es := new(ExecutorPool)
+	es.poolCfg = epCfg
+	es.execCfg = cfg
+	es.lc = newLifecycle()
+	if epCfg.WorkStealing {
+		es.asyncGroup = newExecutorGroup(false, es.taskStolen)
+		es.blockingGroup = newExecutorGroup(true, es.taskStolen)
+	}
 	es.asyncExecutors = make([]Executor, epCfg.AsyncTaskExecutorCount)
 	for i := 0; i < epCfg.AsyncTaskExecutorCount; i++ {
-		es.asyncExecutors[i] = NewExecutor(cfg)
+		es.asyncExecutors[i] = es.newMember(es.asyncGroup)
 	}
 	es.blockingExecutors = make([]Executor, epCfg.BlockingTaskExecutorCount)
 	for i := 0; i < epCfg.BlockingTaskExecutorCount; i++ {
-		es.blockingExecutors[i] = NewExecutor(cfg)
+		es.blockingExecutors[i] = es.newMember(es.blockingGroup)
+	}
+	if epCfg.Autoscaling.Enabled {
+		es.scaler = newAutoscaler(es, epCfg.Autoscaling)
 	}
 	return es
 }
 
-func (es *ExecutorPool) Start() {
+// New executor, part of the work stealing group if there is one.
+func (es *ExecutorPool) newMember(g *executorGroup) Executor {
+	e := NewExecutor(es.execCfg)
+	if t, ok := e.(*thread); ok {
+		t.onEvent = es.taskEvent
+		if g != nil {
+			g.join(t)
+		}
+	}
+	return e
+}
+
+func (es *ExecutorPool) taskEvent(ev taskEvent, tsk Task, executor int, resp *Response) {
+	if es.observer != nil {
+		es.observer(ev, tsk, executor, resp)
+	}
+}
+
+func (es *ExecutorPool) taskStolen(blocking bool) {
+	if es.stats != nil {
+		es.stats.taskStolen(blocking)
+	}
+}
+
+// Start all executors. The pool can be started only once.
+func (es *ExecutorPool) Start() error {
+	es.mux.Lock()
+	if err := es.lc.start(); err != nil {
+		es.mux.Unlock()
+		return err
+	}
 	for _, ae := range es.asyncExecutors {
 		ae.Start()
 	}
 	for _, be := range es.blockingExecutors {
 		be.Start()
 	}
+	es.mux.Unlock()
+	if es.scaler != nil {
+		es.scaler.start()
+	}
+	return nil
 }
 
 func (es *ExecutorPool) Submit(tsk Task) error {
-	blocking := tsk.IsBlocking()
-	if blocking {
-		index := 0
-		minEs := es.blockingExecutors[0].HowManyInQueue()
-		for i := 1; i < len(es.blockingExecutors); i++ {
-			if es.blockingExecutors[i].HowManyInQueue() < minEs {
-				index = i
-			}
+	return es.SubmitContext(context.Background(), tsk)
+}
+
+// Submit the task to the least loaded executor of the relevant group. Waiting
+// for the queue space, if executors are configured to wait, is abandoned when
+// the context is done. If the chosen executor is retired in the meantime, the
+// task goes to another one.
+func (es *ExecutorPool) SubmitContext(ctx context.Context, tsk Task) error {
+	for {
+		switch es.lc.get() {
+		case StateNew:
+			return ErrNotStarted
+		case StateShuttingDown, StateTerminated:
+			return ErrShutdown
 		}
-		return es.blockingExecutors[index].Submit(tsk)
+		es.mux.RLock()
+		var target Executor
+		if tsk.IsBlocking() {
+			target = leastLoaded(es.blockingExecutors)
+		} else {
+			target = leastLoaded(es.asyncExecutors)
+		}
+		es.mux.RUnlock()
+		err := target.SubmitContext(ctx, tsk)
+		if !errors.Is(err, ErrShutdown) || !es.isRetired(target) {
+			return err
+		}
+	}
+}
+
+// Whether the executor is no longer part of the pool.
+func (es *ExecutorPool) isRetired(e Executor) bool {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	for _, ae := range es.asyncExecutors {
+		if ae == e {
+			return false
+		}
+	}
+	for _, be := range es.blockingExecutors {
+		if be == e {
+			return false
+		}
+	}
+	return true
+}
+
+// Executor with the fewest tasks in the queue.
+func leastLoaded(executors []Executor) Executor {
+	index := 0
+	minEs := executors[0].HowManyInQueue()
+	for i := 1; i < len(executors); i++ {
+		if n := executors[i].HowManyInQueue(); n < minEs {
+			index = i
+			minEs = n
+		}
+	}
+	return executors[index]
+}
+
+// Change the number of async and blocking executors. New executors start
+// right away if the pool is started. Executors retired while shrinking do
+// not accept new tasks, but finish the tasks already queued on them. New
+// counts become the core counts for the autoscaler, if enabled.
+func (es *ExecutorPool) Resize(async int, blocking int) error {
+	if async < 1 || blocking < 1 {
+		return errors.New("there must be at least one async and one blocking executor")
+	}
+	es.mux.Lock()
+	if state := es.lc.get(); state == StateShuttingDown || state == StateTerminated {
+		es.mux.Unlock()
+		return ErrShutdown
+	}
+	es.asyncExecutors = es.resizeGroup(es.asyncExecutors, async, es.asyncGroup)
+	es.blockingExecutors = es.resizeGroup(es.blockingExecutors, blocking, es.blockingGroup)
+	es.poolCfg.AsyncTaskExecutorCount = async
+	es.poolCfg.BlockingTaskExecutorCount = blocking
+	es.mux.Unlock()
+	if es.scaler != nil {
+		es.scaler.setCore(async, blocking)
+	}
+	return nil
+}
+
+// caller holds the lock
+func (es *ExecutorPool) resizeGroup(executors []Executor, n int, g *executorGroup) []Executor {
+	for len(executors) < n {
+		e := es.newMember(g)
+		if es.lc.isRunning() {
+			e.Start()
+		}
+		executors = append(executors, e)
+	}
+	if len(executors) > n {
+		// retire the most recently added ones
+		retired := executors[n:]
+		executors = executors[:n:n]
+		for _, e := range retired {
+			es.retireExecutor(e)
+		}
+	}
+	return executors
+}
+
+// Caller holds the lock. The executor is tracked until it terminates so that
+// the pool termination can wait for it.
+func (es *ExecutorPool) retireExecutor(e Executor) {
+	if t, ok := e.(*thread); ok {
+		t.retire()
 	} else {
-		index := 0
-		minEs := es.asyncExecutors[0].HowManyInQueue()
-		for i := 1; i < len(es.asyncExecutors); i++ {
-			if es.asyncExecutors[i].HowManyInQueue() < minEs {
-				index = i
-			}
+		e.Shutdown()
+	}
+	live := es.retired[:0]
+	for _, r := range es.retired {
+		if r.State() != StateTerminated {
+			live = append(live, r)
 		}
-		return es.asyncExecutors[index].Submit(tsk)
 	}
+	es.retired = append(live, e)
+}
+
+// Current number of async and blocking executors.
+func (es *ExecutorPool) Size() (int, int) {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	return len(es.asyncExecutors), len(es.blockingExecutors)
 }
 
 func (es *ExecutorPool) HowManyInQueue() int {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
 	tasksInQueue := 0
 	for _, ae := range es.asyncExecutors {
 		tasksInQueue += ae.HowManyInQueue()
@@ -80,15 +262,103 @@ func (es *ExecutorPool) HowManyInQueue() int {
 	return tasksInQueue
 }
 
-func (es *ExecutorPool) Stop() {
-	for _, ae := range es.asyncExecutors {
-		ae.Stop()
+// Stop accepting tasks; tasks already queued on executors are still executed.
+// Use AwaitTermination to wait for them to finish.
+func (es *ExecutorPool) Shutdown() {
+	prev := es.lc.shutdown()
+	if es.scaler != nil {
+		es.scaler.stop()
 	}
-	for _, be := range es.blockingExecutors {
-		be.Stop()
+	for _, e := range es.members() {
+		e.Shutdown()
+	}
+	es.awaitMembers(prev)
+}
+
+// Stop accepting tasks and return the queued tasks which were never started.
+// Tasks in execution are allowed to finish.
+func (es *ExecutorPool) ShutdownNow() []Task {
+	prev := es.lc.shutdown()
+	if es.scaler != nil {
+		es.scaler.stop()
+	}
+	var dropped []Task
+	for _, e := range es.members() {
+		dropped = append(dropped, e.ShutdownNow()...)
+	}
+	es.awaitMembers(prev)
+	return dropped
+}
+
+// All executors including the retired ones still winding down.
+func (es *ExecutorPool) members() []Executor {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	all := make([]Executor, 0, len(es.asyncExecutors)+len(es.blockingExecutors)+len(es.retired))
+	all = append(all, es.asyncExecutors...)
+	all = append(all, es.blockingExecutors...)
+	return append(all, es.retired...)
+}
+
+// The pool was running before the shutdown, so it terminates once all its
+// executors are terminated. It is done in a separate go routine so that
+// shutdown methods do not block.
+func (es *ExecutorPool) awaitMembers(prev LifecycleState) {
+	if prev != StateRunning {
+		return
+	}
+	members := es.members()
+	go func() {
+		for _, e := range members {
+			e.AwaitTermination(context.Background())
+		}
+		es.lc.terminate()
+	}()
+}
+
+// Wait until the pool is terminated after a shutdown or the context is done,
+// in which case the context error is returned.
+func (es *ExecutorPool) AwaitTermination(ctx context.Context) error {
+	return es.lc.await(ctx)
+}
+
+func (es *ExecutorPool) State() LifecycleState {
+	return es.lc.get()
+}
+
+// Same as ShutdownNow, but tasks never started are simply dropped.
+func (es *ExecutorPool) Stop() {
+	es.ShutdownNow()
+}
+
+// Queue depth of an executor of the pool.
+type executorDepth struct {
+	id       int
+	blocking bool
+	depth    int
+}
+
+// Queue depths of the current executors, async ones first.
+func (es *ExecutorPool) queueDepths() []executorDepth {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	result := make([]executorDepth, 0, len(es.asyncExecutors)+len(es.blockingExecutors))
+	add := func(executors []Executor, blocking bool) {
+		for _, e := range executors {
+			id := -1
+			if t, ok := e.(*thread); ok {
+				id = t.id
+			}
+			result = append(result, executorDepth{id, blocking, e.HowManyInQueue()})
+		}
 	}
+	add(es.asyncExecutors, false)
+	add(es.blockingExecutors, true)
+	return result
 }
 
 func (es *ExecutorPool) TotalExecutorCount() int {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
 	return len(es.asyncExecutors) + len(es.blockingExecutors)
 }
@@ -0,0 +1,107 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Future is a handle to the eventual response of a task submitted with
+// SubmitAsync; loosely modelled on the Java Future. The task runs on the
+// executor pool irrespective of whether it is a blocking task or not, the
+// caller collects the response later through Get, GetWithTimeout or by
+// selecting on Done.
+type Future struct {
+	taskId       int
+	submissionId uint64
+	done         chan struct{}
+	resp         Response
+	cancel       context.CancelFunc
+	once         sync.Once
+}
+
+func newFuture(tid int, cancel context.CancelFunc) *Future {
+	f := new(Future)
+	f.taskId = tid
+	f.done = make(chan struct{})
+	f.cancel = cancel
+	return f
+}
+
+// Records the response, only the first one counts. Either the dispatcher
+// house keeping routine delivers the execution response or Cancel delivers
+// a cancelled response, whichever comes first.
+func (f *Future) complete(resp Response) bool {
+	completed := false
+	f.once.Do(func() {
+		f.resp = resp
+		close(f.done)
+		completed = true
+	})
+	if completed {
+		// release resources held by the derived context
+		f.cancel()
+	}
+	return completed
+}
+
+// Id of the task this future is for.
+func (f *Future) TaskId() int {
+	return f.taskId
+}
+
+// Id the dispatcher assigned to the submission.
+func (f *Future) SubmissionId() uint64 {
+	return f.submissionId
+}
+
+// Blocks until the task response is available and returns it.
+func (f *Future) Get() *Response {
+	<-f.done
+	return &f.resp
+}
+
+// Waits at the most for the given duration for the task response. If the
+// response does not arrive in time, context.DeadlineExceeded is returned.
+func (f *Future) GetWithTimeout(d time.Duration) (error, *Response) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-f.done:
+		return nil, &f.resp
+	case <-timer.C:
+		return context.DeadlineExceeded, nil
+	}
+}
+
+// Channel which is closed once the response is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Whether the response is available, including a cancelled one.
+func (f *Future) IsDone() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cancel the task. If the task is still in the executor queue it will not be
+// executed; a running task is not interrupted but its response is discarded.
+// Returns false if the future was already done.
+func (f *Future) Cancel() bool {
+	resp := CancelledResponse(f.taskId)
+	resp.SubmissionId = f.submissionId
+	return f.complete(*resp)
+}
+
+// Whether the future was completed by cancellation.
+func (f *Future) IsCancelled() bool {
+	return f.IsDone() && f.resp.Status == TaskStatusCancelled
+}
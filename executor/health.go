@@ -0,0 +1,144 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"time"
+)
+
+// Metrics in the health report of an execution service, what threshold rules
+// can be set on.
+const (
+	HealthMetricQueueDepth         = "queue_depth"              // tasks queued on all executors
+	HealthMetricMaxQueueDepth      = "max_executor_queue_depth" // tasks queued on the busiest executor
+	HealthMetricTasksInExecution   = "tasks_in_execution"
+	HealthMetricTasksSubmitted     = "tasks_submitted_total"
+	HealthMetricTasksRejected      = "tasks_rejected_total"
+	HealthMetricTasksFailed        = "tasks_failed_total"
+	HealthMetricOldestInFlight     = "oldest_in_flight_seconds" // since submission of the oldest task not ended
+	HealthMetricOldestRunning      = "oldest_running_seconds"   // since the oldest running attempt started
+	HealthMetricResponseChansInUse = "response_channels_in_use"
+)
+
+// Names of the rules built from MonitoringCfg.
+const (
+	HealthRuleQueueDepth    = "queue_depth"
+	HealthRuleRejectionRate = "rejection_rate"
+	HealthRuleStuckTasks    = "stuck_tasks"
+)
+
+// Health of the service: DOWN unless it is running with executors, DEGRADED
+// when every response channel is at capacity so that blocking tasks cannot be
+// submitted without waiting. Metrics carry the queue depths, counters and the
+// age of the oldest tasks for threshold rules.
+func (es ExecutionService) CheckHealth() util.HealthReport {
+	disp := es.taskDispatcher
+	report := util.HealthReport{Status: util.HealthUp, Details: make(map[string]string), Metrics: make(map[string]float64)}
+	now := time.Now()
+
+	state := disp.State()
+	report.Details["state"] = state.String()
+	if state != StateRunning {
+		report.Status = util.HealthDown
+	}
+
+	depths := disp.execPool.queueDepths()
+	if len(depths) == 0 {
+		report.Status = util.HealthDown
+		report.Details["executors"] = "no executors"
+	}
+	total, deepest := 0, 0
+	for _, d := range depths {
+		total += d.depth
+		if d.depth > deepest {
+			deepest = d.depth
+		}
+	}
+	report.Metrics[HealthMetricQueueDepth] = float64(total)
+	report.Metrics[HealthMetricMaxQueueDepth] = float64(deepest)
+
+	inUse := disp.respChans.inUse()
+	busy, full := 0, 0
+	for _, n := range inUse {
+		if n > 0 {
+			busy++
+		}
+		if n >= disp.respChans.capacity {
+			full++
+		}
+	}
+	report.Metrics[HealthMetricResponseChansInUse] = float64(busy)
+	if len(inUse) > 0 && full == len(inUse) {
+		report.Status = report.Status.Worst(util.HealthDegraded)
+		report.Details["response_channels"] = fmt.Sprintf("all %d channels at capacity", len(inUse))
+	}
+
+	disp.JobStats.Lock()
+	report.Metrics[HealthMetricTasksInExecution] = float64(disp.JobStats.TasksInExecution)
+	report.Metrics[HealthMetricTasksSubmitted] = float64(disp.JobStats.TotalTasksSubmitted)
+	report.Metrics[HealthMetricTasksRejected] = float64(disp.JobStats.Rejected.Total())
+	report.Metrics[HealthMetricTasksFailed] = float64(disp.JobStats.Failed.Total())
+	disp.JobStats.Unlock()
+
+	var oldestInFlight, oldestRunning time.Duration
+	for _, info := range disp.ListInFlight() {
+		if age := now.Sub(info.SubmittedAt); age > oldestInFlight {
+			oldestInFlight = age
+		}
+		if info.State == TaskRunning && !info.StartedAt.IsZero() {
+			if age := now.Sub(info.StartedAt); age > oldestRunning {
+				oldestRunning = age
+			}
+		}
+	}
+	report.Metrics[HealthMetricOldestInFlight] = oldestInFlight.Seconds()
+	report.Metrics[HealthMetricOldestRunning] = oldestRunning.Seconds()
+	return report
+}
+
+// Latest health of the service as checked by its monitor, with the threshold
+// rules applied; false till the monitor has polled once.
+func (es *ExecutionService) Health() (util.HealthReport, bool) {
+	return es.Monitor.Health()
+}
+
+// Threshold rules evaluated by the monitor of the service, to add rules or
+// alert handlers to.
+func (es *ExecutionService) HealthRules() *util.HealthRules {
+	return es.healthRules
+}
+
+// Rules as configured; a rule is left out when its threshold is zero. Alerts
+// are logged.
+func (mc MonitoringCfg) healthRules() *util.HealthRules {
+	hr, _ := util.NewHealthRules()
+	if mc.QueueDepthThreshold > 0 {
+		hr.Add(util.ThresholdRule{
+			Name:       HealthRuleQueueDepth,
+			Metric:     HealthMetricQueueDepth,
+			Threshold:  float64(mc.QueueDepthThreshold),
+			For:        time.Duration(mc.QueueDepthForSeconds) * time.Second,
+			Hysteresis: float64(mc.QueueDepthThreshold) / 2,
+		})
+	}
+	if mc.RejectionRateThreshold > 0 {
+		hr.Add(util.ThresholdRule{
+			Name:      HealthRuleRejectionRate,
+			Metric:    HealthMetricTasksRejected,
+			Threshold: mc.RejectionRateThreshold,
+			Rate:      true,
+		})
+	}
+	if mc.StuckTaskSeconds > 0 {
+		hr.Add(util.ThresholdRule{
+			Name:      HealthRuleStuckTasks,
+			Metric:    HealthMetricOldestRunning,
+			Threshold: float64(mc.StuckTaskSeconds),
+		})
+	}
+	hr.OnAlert(util.LogAlert)
+	return hr
+}
@@ -0,0 +1,100 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/umeshgeeta/goshared/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecutionServiceHealth(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.WaitForChanAvail = false
+	// polled as often as allowed while nobody reads the monitoring data
+	cfg.Monitoring.MonitoringFrequency = 0
+	cfg.Monitoring.MonDataChanBufSz = 1
+	testEs := cfg.MakeExecServiceFromCfg()
+	assert.Equal(util.HealthDown, testEs.CheckHealth().Status)
+	_, checked := testEs.Health()
+	assert.False(checked)
+
+	var mux sync.Mutex
+	var alerts []util.Alert
+	rules := testEs.HealthRules()
+	rules.OnAlert(func(alert util.Alert) {
+		mux.Lock()
+		alerts = append(alerts, alert)
+		mux.Unlock()
+	})
+	assert.Nil(rules.Add(util.ThresholdRule{
+		Name:      HealthRuleStuckTasks,
+		Metric:    HealthMetricOldestRunning,
+		Threshold: 0.05,
+		Severity:  util.HealthDown,
+	}))
+	testEs.Start()
+
+	report := testEs.CheckHealth()
+	assert.Equal(util.HealthUp, report.Status)
+	assert.Equal("Running", report.Details["state"])
+	assert.Equal(0.0, report.Metrics[HealthMetricQueueDepth])
+
+	// the only response channel is held by a task till it is released
+	release := make(chan struct{})
+	err, f := testEs.SubmitAsync(context.Background(), NewHeldTestTask(true, release))
+	assert.Nil(err)
+	assert.Eventually(func() bool {
+		return testEs.CheckHealth().Metrics[HealthMetricTasksInExecution] == 1.0
+	}, time.Second, time.Millisecond)
+	err, _ = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.ErrorIs(err, ErrNoResponseChannel)
+
+	report = testEs.CheckHealth()
+	assert.Equal(util.HealthDegraded, report.Status)
+	assert.Equal("all 1 channels at capacity", report.Details["response_channels"])
+	assert.Equal(1.0, report.Metrics[HealthMetricTasksRejected])
+	assert.Equal(1.0, report.Metrics[HealthMetricTasksInExecution])
+	assert.Equal(1.0, report.Metrics[HealthMetricResponseChansInUse])
+
+	// the monitor fires the rule once the task runs long enough
+	assert.Eventually(func() bool {
+		report, _ := testEs.Health()
+		return report.Status == util.HealthDown
+	}, time.Second, time.Millisecond)
+	report, _ = testEs.Health()
+	assert.Contains(report.Details, "rule."+HealthRuleStuckTasks)
+	assert.Len(testEs.Monitor.Alerts(), 1)
+	mux.Lock()
+	if assert.Len(alerts, 1) {
+		assert.Equal(util.AlertFiring, alerts[0].State)
+		assert.Equal(testEs.Name(), alerts[0].Entity)
+	}
+	mux.Unlock()
+
+	// and resolves it once the task is done
+	close(release)
+	f.Get()
+	assert.Eventually(func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(alerts) == 2
+	}, time.Second, time.Millisecond)
+	mux.Lock()
+	if assert.Len(alerts, 2) {
+		assert.Equal(util.AlertResolved, alerts[1].State)
+	}
+	mux.Unlock()
+	assert.Eventually(func() bool {
+		report, _ := testEs.Health()
+		return report.Status == util.HealthUp
+	}, time.Second, time.Millisecond)
+
+	testEs.Stop()
+	assert.Equal(util.HealthDown, testEs.CheckHealth().Status)
+}
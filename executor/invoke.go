@@ -0,0 +1,88 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+)
+
+// Submit all the tasks and wait for all of them to complete. Responses are
+// in the same order as the tasks. A task which cannot be submitted gets a
+// response of status TaskStatusFailedToSubmit carrying the error; tasks not
+// complete by the time the context is done get a cancelled response.
+func (es *ExecutionService) InvokeAll(ctx context.Context, tasks []Task) []Response {
+	futures := make([]*Future, len(tasks))
+	responses := make([]Response, len(tasks))
+	for i, tsk := range tasks {
+		err, f := es.SubmitAsync(ctx, tsk)
+		if err != nil {
+			resp := FailedToSubmitResponse(taskIdOf(tsk))
+			resp.Errors = []error{err}
+			responses[i] = *resp
+			continue
+		}
+		futures[i] = f
+	}
+	for i, f := range futures {
+		if f != nil {
+			responses[i] = *f.Get()
+		}
+	}
+	return responses
+}
+
+// Submit all the tasks and return the response of the first one which
+// completes successfully; the remaining ones are cancelled. If none of them
+// succeeds, ErrNoTaskSucceeded is returned along with the last response; if
+// the context is done first, the context error is returned.
+func (es *ExecutionService) InvokeAny(ctx context.Context, tasks []Task) (Response, error) {
+	if len(tasks) == 0 {
+		return Response{}, ErrInvalidTask
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	// losers are cancelled on the way out
+	defer cancel()
+	cs := NewCompletionService(es)
+	var last Response
+	submitted := 0
+	for _, tsk := range tasks {
+		err, _ := cs.Submit(ctx, tsk)
+		if err != nil {
+			resp := FailedToSubmitResponse(taskIdOf(tsk))
+			resp.Errors = []error{err}
+			last = *resp
+			continue
+		}
+		submitted++
+	}
+	for ; submitted > 0; submitted-- {
+		select {
+		case resp := <-cs.Completed():
+			if resp.Status == TaskStatusCompletedSuccessfully {
+				// let the remaining responses be drained so that nobody is
+				// left hanging on the completion channel
+				go drain(cs, submitted-1)
+				return resp, nil
+			}
+			last = resp
+		case <-ctx.Done():
+			go drain(cs, submitted)
+			return last, ctx.Err()
+		}
+	}
+	return last, ErrNoTaskSucceeded
+}
+
+func drain(cs *CompletionService, n int) {
+	for ; n > 0; n-- {
+		<-cs.Completed()
+	}
+}
+
+func taskIdOf(tsk Task) int {
+	if tsk == nil {
+		return 0
+	}
+	return tsk.GetId()
+}
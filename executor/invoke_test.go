@@ -0,0 +1,64 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestInvokeAll(t *testing.T) {
+	assert := assert.New(t)
+	tasks := []Task{NewBlockingTestTask(1000, false), nil, NewBlockingTestTask(100, true)}
+	responses := es.InvokeAll(context.Background(), tasks)
+	assert.Len(responses, 3)
+	assert.Equal(tasks[0].GetId(), responses[0].TaskId)
+	assert.Equal(TaskStatusCompletedSuccessfully, responses[0].Status)
+	assert.Equal(TaskStatusFailedToSubmit, responses[1].Status)
+	assert.ErrorIs(responses[1].Errors[0], ErrInvalidTask)
+	assert.Equal(tasks[2].GetId(), responses[2].TaskId)
+	assert.Equal(TaskStatusCompletedSuccessfully, responses[2].Status)
+}
+
+func TestInvokeAny(t *testing.T) {
+	assert := assert.New(t)
+	winner := NewBlockingTestTask(1000, false)
+	tasks := []Task{NewFlakyTestTask(1, false, nil), winner, NewBlockingTestTask(50000, false)}
+	resp, err := es.InvokeAny(context.Background(), tasks)
+	assert.Nil(err)
+	assert.Equal(winner.GetId(), resp.TaskId)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+
+	tasks = []Task{NewFlakyTestTask(1, false, nil), NewFlakyTestTask(1, true, nil)}
+	resp, err = es.InvokeAny(context.Background(), tasks)
+	assert.ErrorIs(err, ErrNoTaskSucceeded)
+	assert.Equal(TaskStatusCompletedFailed, resp.Status)
+
+	_, err = es.InvokeAny(context.Background(), nil)
+	assert.ErrorIs(err, ErrInvalidTask)
+}
+
+func TestCompletionService(t *testing.T) {
+	assert := assert.New(t)
+	cs := NewCompletionService(es)
+	slow := NewBlockingTestTask(30000, false)
+	fast := NewBlockingTestTask(100, true)
+	err, _ := cs.Submit(context.Background(), slow)
+	assert.Nil(err)
+	err, _ = cs.Submit(context.Background(), fast)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err, resp := cs.Take(ctx)
+	assert.Nil(err)
+	assert.Equal(fast.GetId(), resp.TaskId)
+	resp2 := <-cs.Completed()
+	assert.Equal(slow.GetId(), resp2.TaskId)
+	assert.Eventually(func() bool {
+		return cs.Pending() == 0
+	}, time.Second, time.Millisecond)
+}
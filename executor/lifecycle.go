@@ -0,0 +1,116 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Lifecycle state of executors, executor pool, dispatcher and the execution
+// service. States only move forward:
+//
+//	New -> Running -> ShuttingDown -> Terminated
+//
+// A component which was never started goes from New to Terminated directly
+// when it is shut down. Once shut down, a component cannot be started again.
+type LifecycleState int32
+
+const (
+	StateNew LifecycleState = iota
+	StateRunning
+	StateShuttingDown
+	StateTerminated
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case StateNew:
+		return "New"
+	case StateRunning:
+		return "Running"
+	case StateShuttingDown:
+		return "ShuttingDown"
+	case StateTerminated:
+		return "Terminated"
+	}
+	return fmt.Sprintf("LifecycleState(%d)", int32(s))
+}
+
+type lifecycle struct {
+	mux        sync.Mutex
+	state      LifecycleState
+	terminated chan struct{} // closed on reaching StateTerminated
+}
+
+func newLifecycle() *lifecycle {
+	lc := new(lifecycle)
+	lc.state = StateNew
+	lc.terminated = make(chan struct{})
+	return lc
+}
+
+func (lc *lifecycle) get() LifecycleState {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	return lc.state
+}
+
+func (lc *lifecycle) isRunning() bool {
+	return lc.get() == StateRunning
+}
+
+// New to Running; any other starting state is an error.
+func (lc *lifecycle) start() error {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	if lc.state != StateNew {
+		return fmt.Errorf("%w: %v to %v", ErrIllegalStateTransition, lc.state, StateRunning)
+	}
+	lc.state = StateRunning
+	return nil
+}
+
+// Running to ShuttingDown; the caller is then responsible for calling
+// terminate once the work is over. A component which was never started is
+// terminated right away. Shutting down again is a no-op. Returns the state
+// the component was in before the call.
+func (lc *lifecycle) shutdown() LifecycleState {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	prev := lc.state
+	switch lc.state {
+	case StateNew:
+		lc.terminateLocked()
+	case StateRunning:
+		lc.state = StateShuttingDown
+	}
+	return prev
+}
+
+func (lc *lifecycle) terminate() {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	lc.terminateLocked()
+}
+
+// caller holds the lock
+func (lc *lifecycle) terminateLocked() {
+	if lc.state != StateTerminated {
+		lc.state = StateTerminated
+		close(lc.terminated)
+	}
+}
+
+// Wait until terminated or the context is done, in which case the context
+// error is returned.
+func (lc *lifecycle) await(ctx context.Context) error {
+	select {
+	case <-lc.terminated:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,216 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix of all metric names exported.
+const MetricsNamespace = "goshared_executor"
+
+// Serves the state of an execution service in the Prometheus text exposition
+// format (version 0.0.4). It is opt-in, nothing is exported unless the
+// handler is mounted on an HTTP server; say:
+//
+//	http.Handle("/metrics", NewMetricsExporter(es))
+//
+// Every scrape takes a fresh snapshot, unlike util.Monitor nothing is pushed
+// and so nothing piles up when nobody is reading. Metric names and labels are
+// part of the contract and do not change; all are prefixed with
+// MetricsNamespace:
+//
+//	tasks_submitted_total{kind}            counter   tasks accepted by the dispatcher
+//	tasks_in_execution                     gauge     tasks submitted and not yet ended
+//	tasks_completed_total{kind}            counter   tasks completed successfully
+//	tasks_failed_total{kind}               counter   tasks failed, including panicked ones
+//	tasks_cancelled_total{kind}            counter   tasks cancelled by the caller or at shutdown
+//	tasks_rejected_total{kind}             counter   tasks not accepted or discarded as per the rejection policy
+//	tasks_timed_out_total{kind}            counter   tasks which did not finish within their timeout
+//	tasks_panicked_total                   counter   tasks which panicked
+//	task_retries_total                     counter   executions repeated as per the retry policy
+//	tasks_stolen_total{kind}               counter   tasks taken over by an idle sibling executor
+//	tasks_scheduled_total                  counter   tasks handed over to the scheduler
+//	scheduled_tasks_pending                gauge     scheduled tasks waiting for their turn
+//	queue_wait_seconds                     histogram time from submission to the start of execution
+//	execution_seconds                      histogram time taken by executors
+//	throughput_tasks_per_second{window}    gauge     tasks ended per second, window is 10s or 1m
+//	executors{kind}                        gauge     executors in the pool
+//	executor_queue_depth{executor,kind}    gauge     tasks queued on an executor
+//	executor_utilization_ratio{executor}   gauge     fraction of the last minute an executor was busy
+//	response_channel_tasks{channel}        gauge     tasks waiting for a response on a channel
+//	response_channel_capacity              gauge     how many tasks can wait on a channel
+//	response_channels_in_use               gauge     channels with at least one task waiting
+//	running                                gauge     1 while the service accepts tasks, otherwise 0
+//
+// The kind label is either "blocking" or "async", executor is the executor id
+// and channel the index of the response channel.
+type MetricsExporter struct {
+	es *ExecutionService
+}
+
+func NewMetricsExporter(es *ExecutionService) *MetricsExporter {
+	return &MetricsExporter{es: es}
+}
+
+func (me *MetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(me.Gather())
+}
+
+// Current metrics in the text exposition format.
+func (me *MetricsExporter) Gather() []byte {
+	disp := me.es.taskDispatcher
+	mw := new(metricsWriter)
+	// a serialized copy is consistent and refreshes the sliding window
+	stats := taskStats(disp.JobStats.byteArray())
+	if stats == nil {
+		stats = newTaskStats()
+	}
+
+	mw.family("tasks_submitted_total", "counter", "Tasks accepted by the dispatcher.")
+	mw.kinds("tasks_submitted_total", KindCounts{Blocking: stats.BlockingTasksSubmitted, Async: stats.AsyncTasksSubmitted})
+	mw.family("tasks_in_execution", "gauge", "Tasks submitted and not yet ended.")
+	mw.sample("tasks_in_execution", nil, float64(stats.TasksInExecution))
+	for _, c := range []struct {
+		name   string
+		help   string
+		counts KindCounts
+	}{
+		{"tasks_completed_total", "Tasks completed successfully.", stats.Completed},
+		{"tasks_failed_total", "Tasks failed, including panicked ones.", stats.Failed},
+		{"tasks_cancelled_total", "Tasks cancelled by the caller or at shutdown.", stats.Cancelled},
+		{"tasks_rejected_total", "Tasks not accepted or discarded as per the rejection policy.", stats.Rejected},
+		{"tasks_timed_out_total", "Tasks which did not finish within their timeout.", stats.TimedOut},
+	} {
+		mw.family(c.name, "counter", c.help)
+		mw.kinds(c.name, c.counts)
+	}
+	mw.family("tasks_panicked_total", "counter", "Tasks which panicked.")
+	mw.sample("tasks_panicked_total", nil, float64(stats.TasksPanicked))
+	mw.family("task_retries_total", "counter", "Executions repeated as per the retry policy.")
+	mw.sample("task_retries_total", nil, float64(stats.TaskRetries))
+	mw.family("tasks_stolen_total", "counter", "Tasks taken over by an idle sibling executor.")
+	mw.kinds("tasks_stolen_total", KindCounts{Blocking: stats.BlockingTasksStolen, Async: stats.AsyncTasksStolen})
+	mw.family("tasks_scheduled_total", "counter", "Tasks handed over to the scheduler.")
+	mw.sample("tasks_scheduled_total", nil, float64(stats.TasksScheduled))
+	mw.family("scheduled_tasks_pending", "gauge", "Scheduled tasks waiting for their turn.")
+	mw.sample("scheduled_tasks_pending", nil, float64(stats.ScheduledTasksPending))
+
+	mw.histogram("queue_wait_seconds", "Time from submission to the start of execution.", stats.QueueWait)
+	mw.histogram("execution_seconds", "Time taken by executors.", stats.Execution)
+
+	mw.family("throughput_tasks_per_second", "gauge", "Tasks ended per second over the window.")
+	mw.sample("throughput_tasks_per_second", []string{"window", "10s"}, stats.Throughput10s)
+	mw.sample("throughput_tasks_per_second", []string{"window", "1m"}, stats.Throughput1m)
+
+	depths := disp.execPool.queueDepths()
+	var executors KindCounts
+	for _, d := range depths {
+		executors.add(d.blocking)
+	}
+	mw.family("executors", "gauge", "Executors in the pool.")
+	mw.kinds("executors", executors)
+	mw.family("executor_queue_depth", "gauge", "Tasks queued on an executor.")
+	for _, d := range depths {
+		mw.sample("executor_queue_depth", []string{"executor", strconv.Itoa(d.id), "kind", kindOf(d.blocking)}, float64(d.depth))
+	}
+	mw.family("executor_utilization_ratio", "gauge", "Fraction of the last minute an executor was busy.")
+	ids := make([]int, 0, len(stats.ExecutorUtilization))
+	for id := range stats.ExecutorUtilization {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		mw.sample("executor_utilization_ratio", []string{"executor", strconv.Itoa(id)}, stats.ExecutorUtilization[id])
+	}
+
+	inUse := disp.respChans.inUse()
+	busy := 0
+	mw.family("response_channel_tasks", "gauge", "Tasks waiting for a response on a channel.")
+	for i, n := range inUse {
+		mw.sample("response_channel_tasks", []string{"channel", strconv.Itoa(i)}, float64(n))
+		if n > 0 {
+			busy++
+		}
+	}
+	mw.family("response_channel_capacity", "gauge", "How many tasks can wait on a channel.")
+	mw.sample("response_channel_capacity", nil, float64(disp.respChans.capacity))
+	mw.family("response_channels_in_use", "gauge", "Channels with at least one task waiting.")
+	mw.sample("response_channels_in_use", nil, float64(busy))
+
+	running := 0.0
+	if disp.State() == StateRunning {
+		running = 1
+	}
+	mw.family("running", "gauge", "1 while the service accepts tasks, otherwise 0.")
+	mw.sample("running", nil, running)
+	return mw.buf.Bytes()
+}
+
+func kindOf(blocking bool) string {
+	if blocking {
+		return "blocking"
+	}
+	return "async"
+}
+
+// Writes metrics in the text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (mw *metricsWriter) family(name string, typ string, help string) {
+	fmt.Fprintf(&mw.buf, "# HELP %s_%s %s\n", MetricsNamespace, name, help)
+	fmt.Fprintf(&mw.buf, "# TYPE %s_%s %s\n", MetricsNamespace, name, typ)
+}
+
+// Labels are given as name, value pairs.
+func (mw *metricsWriter) sample(name string, labels []string, value float64) {
+	mw.buf.WriteString(MetricsNamespace)
+	mw.buf.WriteByte('_')
+	mw.buf.WriteString(name)
+	if len(labels) > 0 {
+		mw.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				mw.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&mw.buf, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		mw.buf.WriteByte('}')
+	}
+	mw.buf.WriteByte(' ')
+	mw.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	mw.buf.WriteByte('\n')
+}
+
+func (mw *metricsWriter) kinds(name string, kc KindCounts) {
+	mw.sample(name, []string{"kind", "async"}, float64(kc.Async))
+	mw.sample(name, []string{"kind", "blocking"}, float64(kc.Blocking))
+}
+
+// Buckets are cumulative and in seconds as Prometheus expects.
+func (mw *metricsWriter) histogram(name string, help string, h LatencyHistogram) {
+	mw.family(name, "histogram", help)
+	var cumulative int64
+	for i, bound := range h.Bounds {
+		if i < len(h.Counts) {
+			cumulative += h.Counts[i]
+		}
+		le := strconv.FormatFloat(bound/1000, 'g', -1, 64)
+		mw.sample(name+"_bucket", []string{"le", le}, float64(cumulative))
+	}
+	mw.sample(name+"_bucket", []string{"le", "+Inf"}, float64(h.Count))
+	mw.sample(name+"_sum", nil, h.SumMs/1000)
+	mw.sample(name+"_count", nil, float64(h.Count))
+}
+
+// Label values escape only backslashes, double quotes and new lines.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,81 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	assert := assert.New(t)
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.WaitForChanAvail = false
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	channelFree := func() bool {
+		return testEs.taskDispatcher.respChans.inUse()[0] == 0
+	}
+	for i := 0; i < 2; i++ {
+		err, _ := testEs.Submit(NewBlockingTestTask(1000, true))
+		assert.Nil(err)
+		// house keeping releases the channel right after the response
+		assert.Eventually(channelFree, time.Second, time.Millisecond)
+	}
+	// the only channel is held by the first task till released, the second
+	// one is rejected
+	release := make(chan struct{})
+	err, f := testEs.SubmitAsync(context.Background(), NewHeldTestTask(false, release))
+	assert.Nil(err)
+	err, _ = testEs.Submit(NewBlockingTestTask(10, true))
+	assert.ErrorIs(err, ErrNoResponseChannel)
+
+	server := httptest.NewServer(NewMetricsExporter(testEs))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.Nil(err)
+	defer resp.Body.Close()
+	assert.Equal(200, resp.StatusCode)
+	assert.True(strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4"))
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	for _, line := range []string{
+		`# TYPE goshared_executor_tasks_submitted_total counter`,
+		`goshared_executor_tasks_submitted_total{kind="blocking"} 2`,
+		`goshared_executor_tasks_submitted_total{kind="async"} 1`,
+		`goshared_executor_tasks_completed_total{kind="blocking"} 2`,
+		`goshared_executor_tasks_rejected_total{kind="blocking"} 1`,
+		`goshared_executor_tasks_in_execution 1`,
+		`# TYPE goshared_executor_execution_seconds histogram`,
+		`goshared_executor_execution_seconds_bucket{le="+Inf"} 2`,
+		`goshared_executor_execution_seconds_count 2`,
+		`goshared_executor_executors{kind="async"} 1`,
+		`goshared_executor_response_channel_tasks{channel="0"} 1`,
+		`goshared_executor_response_channel_capacity 1`,
+		`goshared_executor_response_channels_in_use 1`,
+		`goshared_executor_running 1`,
+	} {
+		assert.Contains(text, line+"\n")
+	}
+	// every sample belongs to a declared family
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		assert.True(strings.HasPrefix(line, "# HELP goshared_executor_") ||
+			strings.HasPrefix(line, "# TYPE goshared_executor_") ||
+			strings.HasPrefix(line, "goshared_executor_"), line)
+	}
+
+	close(release)
+	f.Get()
+	assert.Eventually(channelFree, time.Second, time.Millisecond)
+	assert.Contains(string(NewMetricsExporter(testEs).Gather()),
+		"goshared_executor_response_channels_in_use 0\n")
+}
@@ -0,0 +1,128 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"runtime/debug"
+	"time"
+)
+
+// Executes a task on an executor. The task is the one submitted and the
+// context is the one it was submitted with; the innermost handler invokes
+// ExecuteContext or Execute of the task.
+type Handler func(ctx context.Context, tsk Task) Response
+
+// Wraps the execution of every task on executors, configured with
+// ExecCfg.Middleware; to add logging, metrics, auth context and such without
+// touching Task implementations.
+type Middleware func(next Handler) Handler
+
+// Submits a task through the dispatcher. The response is the one the caller
+// of SubmitContext gets, nil for async tasks or when the response is to be
+// collected through a Future.
+type SubmitHandler func(ctx context.Context, tsk Task) (error, *Response)
+
+// Wraps every submission through the dispatcher, configured with
+// DispatcherCfg.SubmitMiddleware. A middleware can change the context, say
+// to add values, which the task is then executed with.
+type SubmitMiddleware func(next SubmitHandler) SubmitHandler
+
+// Handler built from the given one wrapped in the middlewares, the first
+// middleware being the outermost.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Same as Chain for the submit side.
+func ChainSubmit(h SubmitHandler, middleware ...SubmitMiddleware) SubmitHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// The innermost handler.
+func invokeTask(ctx context.Context, tsk Task) Response {
+	if cat, ok := tsk.(ContextTask); ok {
+		return cat.ExecuteContext(ctx)
+	}
+	return tsk.Execute()
+}
+
+// Logs the start and the end of every task execution with util.Log.
+func LoggingMiddleware(next Handler) Handler {
+	return func(ctx context.Context, tsk Task) Response {
+		util.Log(fmt.Sprintf("Task %d started", tsk.GetId()))
+		start := time.Now()
+		resp := next(ctx, tsk)
+		util.Log(fmt.Sprintf("Task %d ended with status %d in %v", tsk.GetId(), resp.Status, time.Since(start)))
+		return resp
+	}
+}
+
+// Recovers a panic of the task, panic(nil) included, into a response of
+// status TaskStatusPanicked. Executors recover panics anyway, but placed last
+// in the chain this lets the middlewares before it see the panicked response
+// instead of being unwound.
+func RecoveryMiddleware(next Handler) Handler {
+	return func(ctx context.Context, tsk Task) (resp Response) {
+		returned := false
+		defer func() {
+			if !returned {
+				pe := &PanicError{TaskId: tsk.GetId(), Value: recover(), Stack: debug.Stack()}
+				util.Log(pe.Error())
+				resp = *PanickedResponse(pe)
+			}
+		}()
+		resp = next(ctx, tsk)
+		returned = true
+		return resp
+	}
+}
+
+// Reports how long every task execution took along with its response.
+func TimingMiddleware(observe func(tsk Task, elapsed time.Duration, resp Response)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, tsk Task) Response {
+			start := time.Now()
+			resp := next(ctx, tsk)
+			observe(tsk, time.Since(start), resp)
+			return resp
+		}
+	}
+}
+
+// Logs every submission and its outcome with util.Log.
+func LoggingSubmitMiddleware(next SubmitHandler) SubmitHandler {
+	return func(ctx context.Context, tsk Task) (error, *Response) {
+		util.Log(fmt.Sprintf("Submitting task %d", tsk.GetId()))
+		start := time.Now()
+		err, resp := next(ctx, tsk)
+		if err != nil {
+			util.Log(fmt.Sprintf("Task %d submission failed in %v: %v", tsk.GetId(), time.Since(start), err))
+		} else {
+			util.Log(fmt.Sprintf("Task %d submitted in %v", tsk.GetId(), time.Since(start)))
+		}
+		return err, resp
+	}
+}
+
+// Reports how long every submission took, including the wait for the response
+// of a blocking task, along with its error if any.
+func TimingSubmitMiddleware(observe func(tsk Task, elapsed time.Duration, err error)) SubmitMiddleware {
+	return func(next SubmitHandler) SubmitHandler {
+		return func(ctx context.Context, tsk Task) (error, *Response) {
+			start := time.Now()
+			err, resp := next(ctx, tsk)
+			observe(tsk, time.Since(start), err)
+			return err, resp
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type userKey struct{}
+
+// Test task which reports the user found in its context as the result.
+type UserTestTask struct {
+	TestTask
+}
+
+func (utt *UserTestTask) ExecuteContext(ctx context.Context) Response {
+	resp := utt.TestTask.Execute()
+	resp.Result, _ = ctx.Value(userKey{}).(string)
+	return resp
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	assert := assert.New(t)
+	var mux sync.Mutex
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, tsk Task) Response {
+				mux.Lock()
+				calls = append(calls, name+" in")
+				mux.Unlock()
+				resp := next(ctx, tsk)
+				mux.Lock()
+				calls = append(calls, name+" out")
+				mux.Unlock()
+				return resp
+			}
+		}
+	}
+	var submitted []time.Duration
+	cfg := createCommonTestCfg(es)
+	cfg.Executor.Middleware = []Middleware{trace("outer"), LoggingMiddleware, trace("inner")}
+	cfg.Dispatcher.SubmitMiddleware = []SubmitMiddleware{
+		LoggingSubmitMiddleware,
+		TimingSubmitMiddleware(func(tsk Task, elapsed time.Duration, err error) {
+			assert.Nil(err)
+			submitted = append(submitted, elapsed)
+		}),
+		// auth context propagation from the submitting side
+		func(next SubmitHandler) SubmitHandler {
+			return func(ctx context.Context, tsk Task) (error, *Response) {
+				return next(context.WithValue(ctx, userKey{}, "alice"), tsk)
+			}
+		},
+	}
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	task := &UserTestTask{TestTask: *NewBlockingTestTask(10, true)}
+	err, resp := testEs.Submit(task)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	assert.Equal("alice", resp.Result)
+	mux.Lock()
+	assert.Equal([]string{"outer in", "inner in", "inner out", "outer out"}, calls)
+	mux.Unlock()
+
+	// async submissions go through the same chain
+	err, f := testEs.SubmitAsync(context.Background(), &UserTestTask{TestTask: *NewBlockingTestTask(10, false)})
+	assert.Nil(err)
+	assert.Equal("alice", f.Get().Result)
+	assert.Len(submitted, 2)
+}
+
+func TestRecoveryAndTimingMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	observed := make(chan Response, 1)
+	cfg := createCommonTestCfg(es)
+	cfg.Executor.Middleware = []Middleware{
+		TimingMiddleware(func(tsk Task, elapsed time.Duration, resp Response) {
+			observed <- resp
+		}),
+		RecoveryMiddleware,
+	}
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	err, resp := testEs.Submit(NewPanickingTestTask(true))
+	assert.Nil(err)
+	assert.Equal(TaskStatusPanicked, resp.Status)
+	// timing saw the panic as a response instead of being unwound
+	assert.Equal(TaskStatusPanicked, (<-observed).Status)
+}
+
+func TestRecoveryMiddlewareNilPanic(t *testing.T) {
+	assert := assert.New(t)
+	h := Chain(invokeTask, RecoveryMiddleware)
+	assert.Equal(TaskStatusPanicked, h(context.Background(), NewNilPanickingTestTask(false)).Status)
+	assert.Equal(TaskStatusCompletedSuccessfully, h(context.Background(), NewTestTask(10)).Status)
+}
@@ -0,0 +1,182 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Span data as per the OTLP/JSON encoding of an ExportTraceServiceRequest, so
+// that it can be posted to any OpenTelemetry collector as is.
+type OtlpTraceRequest struct {
+	ResourceSpans []OtlpResourceSpans `json:"resourceSpans"`
+}
+
+type OtlpResourceSpans struct {
+	Resource   OtlpResource     `json:"resource"`
+	ScopeSpans []OtlpScopeSpans `json:"scopeSpans"`
+}
+
+type OtlpResource struct {
+	Attributes []OtlpKeyValue `json:"attributes"`
+}
+
+type OtlpScopeSpans struct {
+	Scope OtlpScope  `json:"scope"`
+	Spans []OtlpSpan `json:"spans"`
+}
+
+type OtlpScope struct {
+	Name string `json:"name"`
+}
+
+type OtlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []OtlpKeyValue `json:"attributes,omitempty"`
+	Events            []OtlpEvent    `json:"events,omitempty"`
+	Status            OtlpStatus     `json:"status"`
+}
+
+type OtlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value OtlpAnyValue `json:"value"`
+}
+
+type OtlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type OtlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []OtlpKeyValue `json:"attributes,omitempty"`
+}
+
+type OtlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// SPAN_KIND_INTERNAL as per OTLP.
+const otlpSpanKindInternal = 1
+
+// Instrumentation scope name of the exported spans.
+const otlpScopeName = "github.com/umeshgeeta/goshared/executor"
+
+// Where the OTLP exporter sends span data, say an HTTP client posting to a
+// collector or a file.
+type SpanSink interface {
+	Export(req *OtlpTraceRequest) error
+}
+
+// Adapter to use an ordinary function as a SpanSink.
+type SpanSinkFunc func(req *OtlpTraceRequest) error
+
+func (f SpanSinkFunc) Export(req *OtlpTraceRequest) error {
+	return f(req)
+}
+
+// Writes every request as one line of JSON.
+type jsonLinesSpanSink struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+func NewJsonLinesSpanSink(w io.Writer) SpanSink {
+	return &jsonLinesSpanSink{w: w}
+}
+
+func (s *jsonLinesSpanSink) Export(req *OtlpTraceRequest) error {
+	ba, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, err = s.w.Write(append(ba, '\n'))
+	return err
+}
+
+// Tracer sending every finished span to the sink in the OTLP/JSON form.
+// Export errors are logged, never returned to the task.
+type OtlpExporter struct {
+	*SpanTracer
+	serviceName string
+	sink        SpanSink
+}
+
+func NewOtlpExporter(serviceName string, sink SpanSink) *OtlpExporter {
+	oe := new(OtlpExporter)
+	oe.serviceName = serviceName
+	oe.sink = sink
+	oe.SpanTracer = NewSpanTracer(oe.export)
+	return oe
+}
+
+func (oe *OtlpExporter) export(data SpanData) {
+	if err := oe.sink.Export(ToOtlp(oe.serviceName, data)); err != nil {
+		util.Log(fmt.Sprintf("Failed to export span %v: %v", data.SpanId, err))
+	}
+}
+
+// OTLP request carrying the given spans of the service.
+func ToOtlp(serviceName string, spans ...SpanData) *OtlpTraceRequest {
+	otlpSpans := make([]OtlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := OtlpSpan{
+			TraceId:           s.TraceId.String(),
+			SpanId:            s.SpanId.String(),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            OtlpStatus{Code: int(s.Status), Message: s.StatusMessage},
+		}
+		if s.ParentSpanId.IsValid() {
+			span.ParentSpanId = s.ParentSpanId.String()
+		}
+		for _, ev := range s.Events {
+			span.Events = append(span.Events, OtlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Time.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+	return &OtlpTraceRequest{ResourceSpans: []OtlpResourceSpans{{
+		Resource: OtlpResource{Attributes: otlpAttributes(map[string]string{"service.name": serviceName})},
+		ScopeSpans: []OtlpScopeSpans{{
+			Scope: OtlpScope{Name: otlpScopeName},
+			Spans: otlpSpans,
+		}},
+	}}}
+}
+
+// Sorted by key so that the output is stable.
+func otlpAttributes(attributes map[string]string) []OtlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]OtlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, OtlpKeyValue{Key: k, Value: OtlpAnyValue{StringValue: attributes[k]}})
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"runtime/debug"
+)
+
+// Hook invoked by an executor when a task panics, after the panic has been
+// recovered and before the response is reported back. The task is the one
+// which was submitted.
+type PanicHandler func(tsk Task, value any, stack []byte)
+
+// Error carried in Response.Errors of a task which panicked.
+type PanicError struct {
+	TaskId int
+	Value  any    // as passed to panic
+	Stack  []byte // of the executor go routine at the time of the panic
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("task %d panicked: %v\n%s", pe.TaskId, pe.Value, pe.Stack)
+}
+
+// Execute the task, recovering any panic into a response of status
+// TaskStatusPanicked so that the executor go routine lives on. Up to go 1.20
+// recover returns nil for panic(nil), so a flag set once the task returns
+// tells a panic apart rather than the recovered value.
+func executeRecovering(tsk Task, handler PanicHandler, h Handler) (resp Response) {
+	returned := false
+	defer func() {
+		if returned {
+			return
+		}
+		pe := &PanicError{TaskId: tsk.GetId(), Value: recover(), Stack: debug.Stack()}
+		util.Log(pe.Error())
+		resp = *PanickedResponse(pe)
+		if handler != nil {
+			callPanicHandler(handler, unwrapTask(tsk), pe)
+		}
+	}()
+	resp = executeTask(tsk, h)
+	returned = true
+	return resp
+}
+
+// A handler which itself panics must not take down the executor either.
+func callPanicHandler(handler PanicHandler, tsk Task, pe *PanicError) {
+	returned := false
+	defer func() {
+		if !returned {
+			util.Log(fmt.Sprintf("Panic handler panicked for task %d: %v", pe.TaskId, recover()))
+		}
+	}()
+	handler(tsk, pe.Value, pe.Stack)
+	returned = true
+}
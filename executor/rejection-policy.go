@@ -0,0 +1,129 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+)
+
+// What to do with a task which cannot be accepted right away; because the
+// executor queue is full and executors are not configured to wait for space,
+// or because no response channel is available and the dispatcher is not
+// configured to wait for one. Modelled after Java RejectedExecutionHandler.
+type RejectionPolicy string
+
+const (
+	// Submission fails with ErrQueueFull or ErrNoResponseChannel. It is the
+	// default policy.
+	RejectAbort RejectionPolicy = "abort"
+
+	// Task is executed right away in the submitting go routine.
+	RejectCallerRuns RejectionPolicy = "caller_runs"
+
+	// Task next in line in the executor queue is discarded to make space for
+	// the new one. Applies to executors only; the dispatcher aborts instead.
+	RejectDiscardOldest RejectionPolicy = "discard_oldest"
+
+	// New task is discarded.
+	RejectDiscard RejectionPolicy = "discard"
+)
+
+// Custom handling of a rejected task, overriding the rejection policy. The
+// reason is either ErrQueueFull or ErrNoResponseChannel. An error returned
+// goes back to the submitter. Returning nil means the handler took care of
+// the task; when rejected by an executor, the handler is then expected to
+// report a response on the task response channel as someone may be waiting
+// for it. A task rejected by the dispatcher and handled is regarded as
+// discarded as far as the submitter is concerned.
+type RejectionHandler func(tsk Task, reason error) error
+
+// A discarded task is reported back so that whoever is waiting for it is
+// released.
+func reportDiscarded(tsk Task) {
+	if rc := tsk.GetRespChan(); rc != nil {
+		rc <- *DiscardedResponse(tsk.GetId())
+	}
+}
+
+// The executor queue is full; act as per the rejection handler or policy.
+func (t *thread) reject(ctx context.Context, tsk Task) error {
+	if t.rejectionHandler != nil {
+		return t.rejectionHandler(unwrapTask(tsk), ErrQueueFull)
+	}
+	switch t.rejectionPolicy {
+	case RejectCallerRuns:
+		resp := t.execute(tsk)
+		resp.TaskId = tsk.GetId()
+		if rc := tsk.GetRespChan(); rc != nil {
+			rc <- resp
+		}
+	case RejectDiscardOldest:
+		if oldest, ok := t.taskQueue.evictNext(); ok {
+			reportDiscarded(oldest)
+		}
+		added, err := t.taskQueue.put(ctx, tsk, false)
+		if err != nil {
+			return err
+		}
+		if !added {
+			// someone else took the space meanwhile
+			reportDiscarded(tsk)
+		}
+	case RejectDiscard:
+		reportDiscarded(tsk)
+	default:
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// No response channel is available for the task; act as per the rejection
+// handler or policy. Response, if any, is handed to the future when there is
+// one and otherwise returned for blocking tasks.
+func (disp *Dispatcher) reject(ctx context.Context, tsk Task, f *Future) (error, *Response) {
+	callerRuns := disp.rejectionHandler == nil && disp.rejectionPolicy == RejectCallerRuns
+	if callerRuns {
+		// the task runs after all, so it counts as submitted rather than
+		// rejected
+		disp.JobStats.taskSubmitted(tsk.IsBlocking())
+		disp.JobStats.taskHandedOver()
+	} else {
+		disp.JobStats.taskRejected(tsk.IsBlocking())
+	}
+	var resp *Response
+	switch {
+	case disp.rejectionHandler != nil:
+		if err := disp.rejectionHandler(tsk, ErrNoResponseChannel); err != nil {
+			return err, nil
+		}
+		resp = DiscardedResponse(tsk.GetId())
+	case disp.rejectionPolicy == RejectCallerRuns:
+		if ctx != context.Background() {
+			tsk = &contextTask{Task: tsk, ctx: ctx}
+		}
+		r := executeRecovering(tsk, nil, Chain(invokeTask, disp.execPool.execCfg.Middleware...))
+		r.TaskId = tsk.GetId()
+		resp = &r
+	case disp.rejectionPolicy == RejectDiscard:
+		resp = DiscardedResponse(tsk.GetId())
+	default:
+		return ErrNoResponseChannel, nil
+	}
+	// the task is dealt with here, it is a submission nevertheless
+	resp.SubmissionId = nextSubmissionId()
+	info := disp.submissions.done(resp.SubmissionId, *resp)
+	if callerRuns {
+		info.Blocking = tsk.IsBlocking()
+		disp.JobStats.taskDone(info)
+	}
+	if f != nil {
+		f.submissionId = resp.SubmissionId
+		f.complete(*resp)
+		return nil, nil
+	}
+	if tsk.IsBlocking() {
+		return nil, resp
+	}
+	return nil, nil
+}
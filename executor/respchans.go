@@ -4,6 +4,7 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"github.com/umeshgeeta/goshared/util"
 	"sync"
@@ -45,17 +46,18 @@ type responseChannels struct {
 	// blocked on that channel for responses. So the key thing is to track how
 	// many tasks are waiting on that channel regardless of 'len' of the channel
 	// which actually givens messages sitting in the buffer.
-	tasksWaitingOnChn        []int
-	firstAvailable           int
-	channelCount             int
-	mux                      sync.Mutex
-	chanAvail                *util.CondVar
-	waitForChannel           bool
-	continueRun              bool
-	waitingTasksInDispatcher *map[int]waitingTask
+	tasksWaitingOnChn       []int
+	capacity                int // how many tasks can wait on a channel
+	lastClaimed             int
+	channelCount            int
+	mux                     sync.Mutex
+	chanAvail               *util.Condition
+	waitForChannel          bool
+	quit                    chan struct{} // closed to stop the listeners
+	waitingTaskInDispatcher func(taskId int) *waitingTask
 }
 
-func newRC(cc int, cp int, wfc bool, wtid *map[int]waitingTask) *responseChannels {
+func newRC(cc int, cp int, wfc bool, wtid func(taskId int) *waitingTask) *responseChannels {
 	var rc responseChannels
 	rc.responseChannels = make([]chan Response, cc)
 	for ch := range rc.responseChannels {
@@ -64,14 +66,19 @@ func newRC(cc int, cp int, wfc bool, wtid *map[int]waitingTask) *responseChannel
 	rc.tasksWaitingOnChn = make([]int, cc)
 	rc.channelCount = cc
 	rc.waitForChannel = wfc
-	rc.firstAvailable = 0
-	rc.chanAvail = util.NewCondVar(10, 100)
-	rc.waitingTasksInDispatcher = wtid
+	// an unbuffered channel can still serve one task at a time
+	rc.capacity = cp
+	if rc.capacity < 1 {
+		rc.capacity = 1
+	}
+	rc.lastClaimed = cc - 1
+	rc.chanAvail = util.NewCondition()
+	rc.waitingTaskInDispatcher = wtid
+	rc.quit = make(chan struct{})
 	return &rc
 }
 
 func (rc *responseChannels) start() {
-	rc.continueRun = true
 	for ch := range rc.responseChannels {
 		// We are starting 'listener go routines' for each of the channel
 		// which run in the infinite loop until we stop the dispatcher.
@@ -91,32 +98,32 @@ func (rc *responseChannels) start() {
 		// blocked routine, it would need the task result / response so
 		// in this loop we set that once we get the response on the channel.
 		go func(rci chan Response) {
-			for rc.continueRun {
-				var tr Response = <-rci
-				var wt = (*rc.waitingTasksInDispatcher)[tr.TaskId]
-				wt.taskResponse = tr
-				wt.responseReceived = true
-				// update back in the map
-				(*rc.waitingTasksInDispatcher)[tr.TaskId] = wt
-				if wt.blocking {
-					// it is house keeping routine + the original caller
-					wt.cond.Broadcast(2)
-				} else {
-					// it is house keeping routine only
-					wt.cond.Broadcast(1)
+			for {
+				var tr Response
+				select {
+				case tr = <-rci:
+				case <-rc.quit:
+					return
+				}
+				var wt = rc.waitingTaskInDispatcher(tr.TaskId)
+				if wt == nil {
+					util.Log(fmt.Sprintf("unexpected - no waiting task for response %v", tr))
+					continue
 				}
-				util.LogDebug(fmt.Sprintf("Received response %v for taskId %d. Waiting task %v is signaled",
-					wt.taskResponse, tr.TaskId, wt))
+				// releases the house keeping routine and the original
+				// caller if the task is blocking, unless the task is
+				// going to be retried
+				wt.received(tr)
+				util.LogDebug(fmt.Sprintf("Received response %v for taskId %d", tr, tr.TaskId))
 			}
 		}(rc.responseChannels[ch])
 	}
 }
 
+// Stop the listeners. Channels are never closed, an executor finishing a
+// task late must not panic sending its response.
 func (rc *responseChannels) stop() {
-	rc.continueRun = false
-	for ch := range rc.responseChannels {
-		close(rc.responseChannels[ch])
-	}
+	close(rc.quit)
 }
 
 func (rc *responseChannels) markAvailable(ai int) {
@@ -128,82 +135,67 @@ func (rc *responseChannels) markAvailable(ai int) {
 		// let us log for now to find more
 		util.Log("unexpected - marking a channel available which is already free")
 	}
-	if rc.firstAvailable == -1 {
-		rc.firstAvailable = ai
-	}
 	rc.mux.Unlock()
 	// inform to other routines which are waiting
-	rc.chanAvail.Signal()
+	rc.chanAvail.Broadcast()
 }
 
-func (rc *responseChannels) nextAvailChanIndex() (int, chan Response) {
-	var result chan Response = nil
-	var avlIndex = -1
-	avlIndex = rc.firstAvailable
-	if avlIndex > -1 {
-		result = rc.pickFromAvailChannels(avlIndex)
-	} else {
-		if rc.waitForChannel {
-			avlIndex, result = rc.waitForAChannel(avlIndex)
-		}
-		// else we did not find a channel and we are not going to wait; so should return
+// How many tasks are waiting on each channel at present.
+func (rc *responseChannels) inUse() []int {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+	return append([]int(nil), rc.tasksWaitingOnChn...)
+}
+
+// Claim a channel for a task, waiting for one if none is available and we
+// are configured to wait. Returns -1 and nil channel if no channel could be
+// claimed, including when the context is done while waiting.
+func (rc *responseChannels) nextAvailChanIndex(ctx context.Context) (int, chan Response) {
+	avlIndex, result := rc.claim()
+	if result == nil && rc.waitForChannel {
+		avlIndex, result = rc.waitForAChannel(ctx)
 	}
 	return avlIndex, result
 }
 
-func (rc *responseChannels) waitForAChannel(avl int) (int, chan Response) {
-	var avlIndex = avl
-	for avlIndex == -1 {
-		rc.chanAvail.Wait()
-		avlIndex = rc.firstAvailable
-	}
+// Waits until a channel is claimed or the context is done in which case
+// -1 and nil channel are returned.
+func (rc *responseChannels) waitForAChannel(ctx context.Context) (int, chan Response) {
+	var avlIndex = -1
 	var result chan Response = nil
-	result = rc.pickFromAvailChannels(avlIndex)
+	err := rc.chanAvail.WaitUntilContext(ctx, func() bool {
+		avlIndex, result = rc.claim()
+		return result != nil
+	})
+	if err != nil {
+		return -1, nil
+	}
 	return avlIndex, result
 }
 
-func (rc *responseChannels) pickFromAvailChannels(avlIndex int) chan Response {
-	// caller has the lock, so we do not worry about it
-	var result chan Response = nil
+// Pick the channel with the fewest tasks waiting on it, provided it is below
+// the capacity, and count one more task waiting on it. The scan starts after
+// the channel claimed last time so that the load is spread evenly. Checking
+// and counting happen under the same lock, so two tasks can never claim the
+// last slot of a channel.
+func (rc *responseChannels) claim() (int, chan Response) {
 	rc.mux.Lock()
 	defer rc.mux.Unlock()
-	result = rc.responseChannels[avlIndex]
-	i := rc.next(avlIndex)
-	min := rc.tasksWaitingOnChn[i]
-	minIndex := i
-	cap := cap(rc.responseChannels[0]) // all channels are of same capacity
-	found := false
-	for !found && i != rc.firstAvailable {
+	best := -1
+	for k := 1; k <= rc.channelCount; k++ {
+		i := (rc.lastClaimed + k) % rc.channelCount
 		nt := rc.tasksWaitingOnChn[i]
-		if nt == 0 {
-			found = true
-		} else {
-			if nt < cap && nt < min {
-				minIndex = i
-				min = nt
+		if nt < rc.capacity && (best == -1 || nt < rc.tasksWaitingOnChn[best]) {
+			best = i
+			if nt == 0 {
+				break
 			}
 		}
-		i = rc.next(i)
-	}
-	if i == rc.firstAvailable && !found {
-		// we scanned the entire array and
-		// did not find any available channel
-		rc.firstAvailable = -1
-	} else {
-		// got a valid one which is not busy,
-		// we mark that as next available channel index
-		rc.firstAvailable = minIndex
 	}
-	// in any case we need to increase the count of tasks waiting on the channel
-	rc.tasksWaitingOnChn[avlIndex]++
-	return result
-}
-
-func (rc *responseChannels) next(i int) int {
-	j := i
-	j++
-	if j == rc.channelCount {
-		j = 0
+	if best == -1 {
+		return -1, nil
 	}
-	return j
+	rc.tasksWaitingOnChn[best]++
+	rc.lastClaimed = best
+	return best, rc.responseChannels[best]
 }
@@ -3,11 +3,21 @@
 
 package executor
 
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
 const TaskStatusNotSubmitted = 0
 const TaskStatusFailedToSubmit = 1
 const TaskStatusSubmitted = 100
 const TaskStatusCompletedSuccessfully = 200
+const TaskStatusDiscarded = 498
+const TaskStatusCancelled = 499
 const TaskStatusCompletedFailed = 500
+const TaskStatusPanicked = 501
+const TaskStatusTimedOut = 504
 
 type Response struct {
 	// Id of the task to which this response corresponds to
@@ -21,6 +31,14 @@ type Response struct {
 	Result string
 
 	Errors []error
+
+	// How many times the task was executed, more than one if it was retried.
+	// Errors of all the attempts are accumulated in Errors.
+	Attempts int
+
+	// Id the dispatcher assigned to the submission, unique within the
+	// process; zero if the task was never accepted.
+	SubmissionId uint64
 }
 
 func NewResponse(tid int) *Response {
@@ -34,3 +52,37 @@ func FailedToSubmitResponse(tid int) *Response {
 	r.Status = TaskStatusFailedToSubmit
 	return r
 }
+
+// Response of a task which panicked during execution, the panic details are
+// carried as the only error.
+func PanickedResponse(pe *PanicError) *Response {
+	r := NewResponse(pe.TaskId)
+	r.Status = TaskStatusPanicked
+	r.Errors = []error{pe}
+	return r
+}
+
+// Response of a task which did not finish within its timeout. The error
+// carried wraps context.DeadlineExceeded.
+func TimedOutResponse(tid int, timeout time.Duration) *Response {
+	r := NewResponse(tid)
+	r.Status = TaskStatusTimedOut
+	r.Errors = []error{fmt.Errorf("task %d timed out after %v: %w", tid, timeout, context.DeadlineExceeded)}
+	return r
+}
+
+// Response of a task which was discarded as per the rejection policy.
+func DiscardedResponse(tid int) *Response {
+	r := NewResponse(tid)
+	r.Status = TaskStatusDiscarded
+	return r
+}
+
+// Response handed back when the caller's context is done before the task
+// result is available, or when the executor skips a task whose caller has
+// already given up.
+func CancelledResponse(tid int) *Response {
+	r := NewResponse(tid)
+	r.Status = TaskStatusCancelled
+	return r
+}
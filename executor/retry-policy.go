@@ -0,0 +1,81 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Retry policy for tasks which complete with status TaskStatusCompletedFailed.
+// The dispatcher re-submits a failed task after an exponentially growing
+// backoff, without holding up any executor meanwhile. The response handed to
+// the caller in the end records how many attempts were made along with the
+// errors of all of them.
+type RetryPolicy struct {
+
+	// Maximum number of executions including the first one; one or less
+	// means no retry.
+	MaxAttempts int `json:"max_attempts"`
+
+	// Backoff before the first retry, in milliseconds.
+	InitialBackoffMs int `json:"initial_backoff_ms"`
+
+	// Upper limit on the backoff, in milliseconds; zero means no limit.
+	MaxBackoffMs int `json:"max_backoff_ms"`
+
+	// Backoff grows by this factor on every retry, values below 1 are
+	// regarded as 1.
+	Multiplier float64 `json:"multiplier"`
+
+	// Randomization of the backoff, between 0 and 1, as a fraction of the
+	// backoff; so that retries of many failed tasks do not line up.
+	Jitter float64 `json:"jitter"`
+
+	// Optional predicate over errors of the failed attempt deciding whether
+	// it is worth retrying; nil means every failure is retried. Can only be
+	// set programmatically.
+	RetryOn func(errs []error) bool `json:"-"`
+}
+
+// Optional interface a task can implement to carry its own retry policy,
+// overriding the service default. Nil policy means the default applies.
+type RetryableTask interface {
+	Task
+
+	GetRetryPolicy() *RetryPolicy
+}
+
+// Retry policy for the task, falling back to the given default.
+func taskRetryPolicy(tsk Task, defaultPolicy *RetryPolicy) *RetryPolicy {
+	if rt, ok := tsk.(RetryableTask); ok {
+		if rp := rt.GetRetryPolicy(); rp != nil {
+			return rp
+		}
+	}
+	return defaultPolicy
+}
+
+// Whether the response of the given attempt, counting from 1, calls for one
+// more attempt.
+func (rp *RetryPolicy) shouldRetry(resp Response, attempt int) bool {
+	if rp == nil || attempt >= rp.MaxAttempts || resp.Status != TaskStatusCompletedFailed {
+		return false
+	}
+	return rp.RetryOn == nil || rp.RetryOn(resp.Errors)
+}
+
+// Backoff before the given retry, counting from 1.
+func (rp *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := math.Max(rp.Multiplier, 1)
+	d := float64(rp.InitialBackoffMs) * math.Pow(multiplier, float64(retry-1))
+	if rp.MaxBackoffMs > 0 {
+		d = math.Min(d, float64(rp.MaxBackoffMs))
+	}
+	if rp.Jitter > 0 {
+		d += d * math.Min(rp.Jitter, 1) * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d * float64(time.Millisecond))
+}
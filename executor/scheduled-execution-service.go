@@ -0,0 +1,111 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"errors"
+	"time"
+)
+
+// ScheduledExecutionService is an ExecutionService which can also run tasks
+// after a delay or periodically; similar to Java ScheduledExecutorService.
+// Scheduled tasks are executed as async tasks on the same executor pool
+// which serves directly submitted tasks.
+type ScheduledExecutionService struct {
+	*ExecutionService
+	sched *scheduler
+}
+
+// Same as NewExecutionService, the scheduler is configured from the
+// SchedulerSettings segment of the configuration.
+func NewScheduledExecutionService(cfgFileName string, useDefault bool) *ScheduledExecutionService {
+	es := NewExecutionService(cfgFileName, useDefault)
+	return newScheduledExecService(es)
+}
+
+// Build a new scheduled execution service from the given configuration.
+func (esc *ExecServiceCfg) MakeScheduledExecServiceFromCfg() *ScheduledExecutionService {
+	return newScheduledExecService(esc.MakeExecServiceFromCfg())
+}
+
+func newScheduledExecService(es *ExecutionService) *ScheduledExecutionService {
+	ses := new(ScheduledExecutionService)
+	ses.ExecutionService = es
+	ses.sched = newScheduler(es.ServiceCfgInUse.Scheduler, es)
+	return ses
+}
+
+func (ses *ScheduledExecutionService) Start() error {
+	if err := ses.ExecutionService.Start(); err != nil {
+		return err
+	}
+	ses.sched.start()
+	return nil
+}
+
+// Stop the scheduler first, cancelling all pending scheduled tasks, and then
+// the underlying execution service.
+func (ses *ScheduledExecutionService) Stop() {
+	ses.sched.stop()
+	ses.ExecutionService.Stop()
+}
+
+// Cancel pending scheduled tasks and shut down the execution service, runs
+// already submitted are still executed.
+func (ses *ScheduledExecutionService) Shutdown() {
+	ses.sched.stop()
+	ses.ExecutionService.Shutdown()
+}
+
+// Cancel pending scheduled tasks and shut down the execution service right
+// away, returning the submitted tasks which were never started.
+func (ses *ScheduledExecutionService) ShutdownNow() []Task {
+	ses.sched.stop()
+	return ses.ExecutionService.ShutdownNow()
+}
+
+// Run the task once after the given delay.
+func (ses *ScheduledExecutionService) Schedule(tsk Task, delay time.Duration) (error, *ScheduledFuture) {
+	return ses.schedule(tsk, delay, 0, false)
+}
+
+// Run the task periodically, first after the initial delay and thereafter
+// every period measured from when the previous run was due. If a run takes
+// longer than the period, the next run starts late; runs never overlap.
+func (ses *ScheduledExecutionService) ScheduleAtFixedRate(tsk Task, initialDelay time.Duration,
+	period time.Duration) (error, *ScheduledFuture) {
+	if period <= 0 {
+		return errors.New("period must be positive"), nil
+	}
+	return ses.schedule(tsk, initialDelay, period, true)
+}
+
+// Run the task periodically, first after the initial delay and thereafter
+// with the given delay between the end of a run and start of the next one.
+func (ses *ScheduledExecutionService) ScheduleWithFixedDelay(tsk Task, initialDelay time.Duration,
+	delay time.Duration) (error, *ScheduledFuture) {
+	if delay <= 0 {
+		return errors.New("delay must be positive"), nil
+	}
+	return ses.schedule(tsk, initialDelay, delay, false)
+}
+
+func (ses *ScheduledExecutionService) schedule(tsk Task, delay time.Duration, period time.Duration,
+	fixedRate bool) (error, *ScheduledFuture) {
+	if tsk == nil {
+		return ErrInvalidTask, nil
+	}
+	e := &schedEntry{
+		task:      tsk,
+		next:      time.Now().Add(delay),
+		period:    period,
+		fixedRate: fixedRate,
+		index:     -1,
+	}
+	sf := newScheduledFuture(ses.sched, e)
+	if err := ses.sched.add(e, true); err != nil {
+		return err, nil
+	}
+	return nil, sf
+}
@@ -0,0 +1,118 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduledExecutionServiceSchedule(t *testing.T) {
+	assert := assert.New(t)
+	ses := es.CloneCfg().MakeScheduledExecServiceFromCfg()
+	ses.Start()
+	defer ses.Stop()
+
+	start := time.Now()
+	err, sf := ses.Schedule(NewBlockingTestTask(10, true), 20*time.Millisecond)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, sf.Get().Status)
+	assert.GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+	assert.Equal(1, sf.Runs())
+	assert.False(sf.IsCancelled())
+
+	// cancelled before it is due, it never runs
+	err, sf2 := ses.Schedule(NewBlockingTestTask(10, false), time.Hour)
+	assert.Nil(err)
+	assert.Greater(sf2.Delay(), time.Minute)
+	assert.True(sf2.Cancel())
+	assert.True(sf2.IsDone())
+	assert.True(sf2.IsCancelled())
+	assert.Equal(0, sf2.Runs())
+
+	stats := taskStats(ses.GetData().Data)
+	assert.Equal(2, stats.TasksScheduled)
+	assert.Equal(0, stats.ScheduledTasksPending)
+}
+
+func TestScheduledExecutionServicePeriodic(t *testing.T) {
+	assert := assert.New(t)
+	ses := es.CloneCfg().MakeScheduledExecServiceFromCfg()
+	ses.Start()
+	defer ses.Stop()
+
+	err, rate := ses.ScheduleAtFixedRate(NewBlockingTestTask(10, false), 0, 5*time.Millisecond)
+	assert.Nil(err)
+	err, delay := ses.ScheduleWithFixedDelay(NewBlockingTestTask(10, false), 0, 5*time.Millisecond)
+	assert.Nil(err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (rate.Runs() < 3 || delay.Runs() < 3) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.GreaterOrEqual(rate.Runs(), 3)
+	assert.GreaterOrEqual(delay.Runs(), 3)
+
+	assert.True(rate.Cancel())
+	assert.True(delay.Cancel())
+	assert.False(rate.Cancel())
+	assert.True(rate.IsCancelled())
+
+	err, _ = ses.ScheduleAtFixedRate(NewBlockingTestTask(10, false), 0, 0)
+	assert.NotNil(err)
+}
+
+func TestScheduledExecutionServiceBlockedSubmit(t *testing.T) {
+	assert := assert.New(t)
+	held := NewBlockingTestTask(10, false)
+	release := make(chan struct{})
+	var mux sync.Mutex
+	executed := make(map[int]bool)
+	cfg := es.CloneCfg()
+	// submission of the held task waits till released or cancelled
+	cfg.Dispatcher.SubmitMiddleware = []SubmitMiddleware{func(next SubmitHandler) SubmitHandler {
+		return func(ctx context.Context, tsk Task) (error, *Response) {
+			if tsk.GetId() == held.GetId() {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return ctx.Err(), nil
+				}
+			}
+			return next(ctx, tsk)
+		}
+	}}
+	cfg.Executor.Middleware = []Middleware{func(next Handler) Handler {
+		return func(ctx context.Context, tsk Task) Response {
+			mux.Lock()
+			executed[tsk.GetId()] = true
+			mux.Unlock()
+			return next(ctx, tsk)
+		}
+	}}
+	ses := cfg.MakeScheduledExecServiceFromCfg()
+	ses.Start()
+	defer ses.Stop()
+	defer close(release)
+
+	err, heldSf := ses.Schedule(held, 0)
+	assert.Nil(err)
+	err, sf := ses.Schedule(NewBlockingTestTask(10, false), 10*time.Millisecond)
+	assert.Nil(err)
+	// the held submission does not delay other scheduled tasks
+	assert.Equal(TaskStatusCompletedSuccessfully, sf.Get().Status)
+	assert.False(heldSf.IsDone())
+
+	// cancelled while its submission waits, it never runs
+	assert.True(heldSf.Cancel())
+	assert.Equal(TaskStatusCancelled, heldSf.Get().Status)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(0, heldSf.Runs())
+	mux.Lock()
+	assert.False(executed[held.GetId()])
+	mux.Unlock()
+}
@@ -0,0 +1,377 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/umeshgeeta/goshared/util"
+	"sync"
+	"time"
+)
+
+// Scheduler configuration parameters
+type SchedulerCfg struct {
+
+	// Maximum number of scheduled tasks waiting for their turn to run. Any
+	// attempt to schedule more tasks fails. Zero means there is no limit.
+	MaxPendingTasks int `json:"max_pending_tasks"`
+
+	// By default, like in Java, a periodic task is not run any further once
+	// a run fails. If true, subsequent runs continue to be scheduled.
+	ContinueOnFailure bool `json:"continue_on_failure"`
+}
+
+// One entry in the timer heap; a task along with when it should run next
+// and, for periodic tasks, how the next run time is computed.
+type schedEntry struct {
+	task      Task
+	next      time.Time
+	period    time.Duration // zero for one shot tasks
+	fixedRate bool          // else fixed delay, applies to periodic tasks only
+	seq       uint64        // tie breaker so that entries due at the same time run in order
+	index     int           // position in the heap, -1 when not in the heap
+	sf        *ScheduledFuture
+}
+
+// Min heap of scheduled entries ordered on next run time.
+type schedHeap []*schedEntry
+
+func (h schedHeap) Len() int {
+	return len(h)
+}
+
+func (h schedHeap) Less(i, j int) bool {
+	if h[i].next.Equal(h[j].next) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].next.Before(h[j].next)
+}
+
+func (h schedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *schedHeap) Push(x any) {
+	e := x.(*schedEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *schedHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// The scheduler keeps all scheduled tasks in a single timer heap and uses one
+// go routine which sleeps until the earliest task is due. Due tasks are
+// submitted to the execution service as async tasks, each from a go routine
+// of its own so that a submission waiting for a response channel or queue
+// space does not hold up other tasks; periodic tasks are put back in the heap
+// once the run completes so that runs of the same task never overlap.
+type scheduler struct {
+	mux     sync.Mutex
+	entries schedHeap
+	seq     uint64
+	cfg     SchedulerCfg
+	es      *ExecutionService
+	wakeup  chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running bool
+}
+
+func newScheduler(cfg SchedulerCfg, es *ExecutionService) *scheduler {
+	s := new(scheduler)
+	s.cfg = cfg
+	s.es = es
+	s.wakeup = make(chan struct{}, 1)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *scheduler) start() {
+	s.mux.Lock()
+	s.running = true
+	s.mux.Unlock()
+	go s.run()
+}
+
+// Stop the scheduler; all pending scheduled tasks are cancelled.
+func (s *scheduler) stop() {
+	s.mux.Lock()
+	s.running = false
+	pending := s.entries
+	for _, e := range pending {
+		e.index = -1
+	}
+	s.entries = nil
+	s.updatePendingStats()
+	s.mux.Unlock()
+	s.cancel()
+	for _, e := range pending {
+		e.sf.finish(*CancelledResponse(e.task.GetId()), true)
+	}
+}
+
+func (s *scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		var due []*schedEntry
+		wait := time.Hour // nothing scheduled, we still wake up once in a while
+		s.mux.Lock()
+		now := time.Now()
+		for s.entries.Len() > 0 && !s.entries[0].next.After(now) {
+			due = append(due, heap.Pop(&s.entries).(*schedEntry))
+		}
+		if s.entries.Len() > 0 {
+			wait = s.entries[0].next.Sub(now)
+		}
+		s.updatePendingStats()
+		s.mux.Unlock()
+
+		for _, e := range due {
+			go s.fire(e)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wakeup:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Add the entry in the heap and nudge the scheduler routine in case the
+// entry is due before whatever it is sleeping for.
+func (s *scheduler) add(e *schedEntry, isNew bool) error {
+	s.mux.Lock()
+	if !s.running {
+		s.mux.Unlock()
+		return errors.New("scheduler is not running")
+	}
+	if isNew && s.cfg.MaxPendingTasks > 0 && s.entries.Len() >= s.cfg.MaxPendingTasks {
+		s.mux.Unlock()
+		return errors.New("cannot schedule, maximum number of pending scheduled tasks reached")
+	}
+	s.seq++
+	e.seq = s.seq
+	heap.Push(&s.entries, e)
+	s.updatePendingStats()
+	s.mux.Unlock()
+	if isNew {
+		s.es.taskDispatcher.JobStats.taskScheduled()
+	}
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+		// wake up is already pending
+	}
+	return nil
+}
+
+// Remove the entry from the heap if it is still waiting there.
+func (s *scheduler) remove(e *schedEntry) {
+	s.mux.Lock()
+	if e.index >= 0 && e.index < s.entries.Len() && s.entries[e.index] == e {
+		heap.Remove(&s.entries, e.index)
+		s.updatePendingStats()
+	}
+	s.mux.Unlock()
+}
+
+// caller holds the lock
+func (s *scheduler) updatePendingStats() {
+	s.es.taskDispatcher.JobStats.setPendingScheduled(s.entries.Len())
+}
+
+// Submit the due task for execution and, once done, decide about the next run.
+func (s *scheduler) fire(e *schedEntry) {
+	if e.sf.IsDone() {
+		// cancelled in the meantime
+		return
+	}
+	err, f := s.es.SubmitAsync(e.sf.ctx, e.task)
+	if err != nil {
+		if e.sf.IsDone() {
+			// cancelled while waiting for the submission
+			return
+		}
+		util.Log(fmt.Sprintf("Failed to submit scheduled task %d: %v", e.task.GetId(), err))
+		s.completed(e, *FailedToSubmitResponse(e.task.GetId()))
+		return
+	}
+	e.sf.running(f)
+	go func() {
+		s.completed(e, *f.Get())
+	}()
+}
+
+func (s *scheduler) completed(e *schedEntry, resp Response) {
+	e.sf.ran(resp)
+	if e.period == 0 {
+		e.sf.finish(resp, false)
+		return
+	}
+	if resp.Status != TaskStatusCompletedSuccessfully && !s.cfg.ContinueOnFailure {
+		e.sf.finish(resp, false)
+		return
+	}
+	s.mux.Lock()
+	if e.fixedRate {
+		// next run is relative to when this run was due; if it is already
+		// past, the run starts late but right away
+		e.next = e.next.Add(e.period)
+	} else {
+		e.next = time.Now().Add(e.period)
+	}
+	s.mux.Unlock()
+	if e.sf.IsDone() {
+		return
+	}
+	if err := s.add(e, false); err != nil {
+		e.sf.finish(*CancelledResponse(e.task.GetId()), true)
+	}
+}
+
+// ScheduledFuture is the handle to a scheduled task. For a one shot task it is
+// done once the task runs; for a periodic task it is done only when it is
+// cancelled, the scheduler stops or a run fails (unless the scheduler is
+// configured to continue on failure).
+type ScheduledFuture struct {
+	mux       sync.Mutex
+	entry     *schedEntry
+	sched     *scheduler
+	ctx       context.Context // of submissions, cancelled along with the future
+	cancelCtx context.CancelFunc
+	current   *Future
+	runs      int
+	last      Response
+	cancelled bool
+	done      chan struct{}
+	once      sync.Once
+}
+
+func newScheduledFuture(s *scheduler, e *schedEntry) *ScheduledFuture {
+	sf := new(ScheduledFuture)
+	sf.sched = s
+	sf.entry = e
+	sf.done = make(chan struct{})
+	sf.ctx, sf.cancelCtx = context.WithCancel(s.ctx)
+	e.sf = sf
+	return sf
+}
+
+// The run is submitted. If the scheduled task is cancelled meanwhile, Cancel
+// may have missed the future, so it is cancelled here.
+func (sf *ScheduledFuture) running(f *Future) {
+	sf.mux.Lock()
+	sf.current = f
+	sf.mux.Unlock()
+	if sf.IsDone() {
+		f.Cancel()
+	}
+}
+
+func (sf *ScheduledFuture) ran(resp Response) {
+	sf.mux.Lock()
+	sf.current = nil
+	sf.runs++
+	sf.last = resp
+	sf.mux.Unlock()
+}
+
+func (sf *ScheduledFuture) finish(resp Response, cancelled bool) bool {
+	finished := false
+	sf.once.Do(func() {
+		sf.mux.Lock()
+		sf.last = resp
+		sf.cancelled = cancelled
+		sf.mux.Unlock()
+		close(sf.done)
+		// a submission still waiting gives up
+		sf.cancelCtx()
+		finished = true
+	})
+	return finished
+}
+
+// Cancel the scheduled task. No further runs take place; a run in progress
+// is cancelled as well. Returns false if the scheduled task was already done.
+func (sf *ScheduledFuture) Cancel() bool {
+	if !sf.finish(*CancelledResponse(sf.entry.task.GetId()), true) {
+		return false
+	}
+	sf.sched.remove(sf.entry)
+	sf.mux.Lock()
+	f := sf.current
+	sf.mux.Unlock()
+	if f != nil {
+		f.Cancel()
+	}
+	return true
+}
+
+// Whether the scheduled task was cancelled.
+func (sf *ScheduledFuture) IsCancelled() bool {
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	return sf.cancelled
+}
+
+// Whether the scheduled task is done; it will not run any more.
+func (sf *ScheduledFuture) IsDone() bool {
+	select {
+	case <-sf.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Channel which is closed once the scheduled task is done.
+func (sf *ScheduledFuture) Done() <-chan struct{} {
+	return sf.done
+}
+
+// Blocks until the scheduled task is done and returns the last response.
+func (sf *ScheduledFuture) Get() *Response {
+	<-sf.done
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	resp := sf.last
+	return &resp
+}
+
+// How many times the task has run so far.
+func (sf *ScheduledFuture) Runs() int {
+	sf.mux.Lock()
+	defer sf.mux.Unlock()
+	return sf.runs
+}
+
+// Remaining time till the next run; negative if the run is overdue.
+func (sf *ScheduledFuture) Delay() time.Duration {
+	sf.sched.mux.Lock()
+	defer sf.sched.mux.Unlock()
+	return time.Until(sf.entry.next)
+}
@@ -0,0 +1,159 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every submission through the dispatcher is given an id of its own, unique
+// across all dispatchers of the process, irrespective of the id the client
+// has chosen for the task. The log tracks what happens to submissions in
+// flight and keeps the most recently finished ones so that they can be looked
+// up by the submission id.
+type submissionLog struct {
+	mux      sync.Mutex
+	inFlight map[uint64]*TaskInfo
+	byTask   map[int]uint64 // task ids in flight are unique
+	finished map[uint64]TaskInfo
+	order    []uint64 // finished submission ids, oldest first
+	capacity int      // how many finished submissions are remembered
+}
+
+// Last submission id handed out, shared by all dispatchers.
+var lastSubmissionId uint64
+
+func nextSubmissionId() uint64 {
+	return atomic.AddUint64(&lastSubmissionId, 1)
+}
+
+func newSubmissionLog(capacity int) *submissionLog {
+	sl := new(submissionLog)
+	sl.inFlight = make(map[uint64]*TaskInfo)
+	sl.byTask = make(map[int]uint64)
+	sl.finished = make(map[uint64]TaskInfo)
+	if capacity > 0 {
+		sl.capacity = capacity
+	}
+	return sl
+}
+
+// Assign a submission id to the waiting task and track it as queued.
+func (sl *submissionLog) started(wt *waitingTask) uint64 {
+	id := nextSubmissionId()
+	wt.submissionId = id
+	info := &TaskInfo{
+		SubmissionId: id,
+		TaskId:       wt.task.GetId(),
+		Blocking:     wt.blocking,
+		State:        TaskQueued,
+		Executor:     -1,
+		SubmittedAt:  time.Now(),
+	}
+	sl.mux.Lock()
+	sl.inFlight[id] = info
+	sl.byTask[info.TaskId] = id
+	sl.mux.Unlock()
+	return id
+}
+
+// An executor started the task with the given id; tasks not submitted
+// through the dispatcher are ignored.
+func (sl *submissionLog) running(taskId int, executor int) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if info, ok := sl.inFlight[sl.byTask[taskId]]; ok {
+		info.State = TaskRunning
+		info.Executor = executor
+		info.Attempts++
+		info.StartedAt = time.Now()
+	}
+}
+
+// The task failed and is waiting to be retried.
+func (sl *submissionLog) requeued(id uint64) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if info, ok := sl.inFlight[id]; ok {
+		info.State = TaskQueued
+	}
+}
+
+// Remember the final response of the submission, forgetting the oldest one
+// if we are at the capacity. Submissions dealt with by the rejection policy
+// are never in flight, they are recorded here straight away. Returns the
+// final info of the submission.
+func (sl *submissionLog) done(id uint64, resp Response) TaskInfo {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	now := time.Now()
+	info, ok := sl.inFlight[id]
+	if ok {
+		delete(sl.inFlight, id)
+		// the task id may be taken by a new submission already
+		if sl.byTask[info.TaskId] == id {
+			delete(sl.byTask, info.TaskId)
+		}
+	} else {
+		info = &TaskInfo{SubmissionId: id, TaskId: resp.TaskId, Executor: -1, SubmittedAt: now}
+	}
+	info.State = finalState(resp.Status)
+	info.EndedAt = now
+	info.Response = &resp
+	if sl.capacity == 0 {
+		return *info
+	}
+	if len(sl.order) == sl.capacity {
+		delete(sl.finished, sl.order[0])
+		sl.order = sl.order[1:]
+	}
+	sl.finished[id] = *info
+	sl.order = append(sl.order, id)
+	return *info
+}
+
+// Returns false if the id is unknown or already forgotten.
+func (sl *submissionLog) status(id uint64) (TaskInfo, bool) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	if info, ok := sl.inFlight[id]; ok {
+		return *info, true
+	}
+	info, ok := sl.finished[id]
+	return info, ok
+}
+
+// Submissions queued or running, in the order they were made.
+func (sl *submissionLog) listInFlight() []TaskInfo {
+	sl.mux.Lock()
+	result := make([]TaskInfo, 0, len(sl.inFlight))
+	for _, info := range sl.inFlight {
+		result = append(result, *info)
+	}
+	sl.mux.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SubmissionId < result[j].SubmissionId
+	})
+	return result
+}
+
+// Response for the submission; status is TaskStatusSubmitted while the task
+// is in flight. Returns false if the id is unknown or already forgotten.
+func (sl *submissionLog) lookup(id uint64) (*Response, bool) {
+	info, ok := sl.status(id)
+	if !ok {
+		return nil, false
+	}
+	if info.Response != nil {
+		resp := *info.Response
+		return &resp, true
+	}
+	resp := NewResponse(info.TaskId)
+	resp.Status = TaskStatusSubmitted
+	resp.SubmissionId = id
+	return resp, true
+}
@@ -0,0 +1,82 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Where a submitted task is in its life. Unlike the response status, which
+// is known only at the end, the state can be queried any time through
+// ExecutionService.Status.
+type TaskState int
+
+const (
+	// Waiting in an executor queue; also while waiting to be retried.
+	TaskQueued TaskState = iota
+	TaskRunning
+	TaskCompleted
+	TaskFailed
+	TaskCancelled
+	TaskTimedOut
+)
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskQueued:
+		return "Queued"
+	case TaskRunning:
+		return "Running"
+	case TaskCompleted:
+		return "Completed"
+	case TaskFailed:
+		return "Failed"
+	case TaskCancelled:
+		return "Cancelled"
+	case TaskTimedOut:
+		return "TimedOut"
+	}
+	return fmt.Sprintf("TaskState(%d)", int(s))
+}
+
+// Whether the task is done, one way or the other.
+func (s TaskState) IsFinal() bool {
+	return s >= TaskCompleted
+}
+
+// Final state corresponding to the response status.
+func finalState(status int) TaskState {
+	switch status {
+	case TaskStatusCompletedSuccessfully:
+		return TaskCompleted
+	case TaskStatusCancelled, TaskStatusDiscarded:
+		return TaskCancelled
+	case TaskStatusTimedOut:
+		return TaskTimedOut
+	}
+	return TaskFailed
+}
+
+// Snapshot of what happened to a submission so far.
+type TaskInfo struct {
+	SubmissionId uint64
+	TaskId       int
+	Blocking     bool
+	State        TaskState
+
+	// Id of the executor which runs or last ran the task, -1 if the task
+	// never reached the head of a queue.
+	Executor int
+
+	// Number of times the task was started, more than one if retried.
+	Attempts int
+
+	SubmittedAt time.Time
+	StartedAt   time.Time // of the latest attempt, zero if never started
+	EndedAt     time.Time // zero unless the state is final
+
+	// Final response, nil unless the state is final.
+	Response *Response
+}
@@ -0,0 +1,208 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"time"
+)
+
+// Upper bounds, in milliseconds, of latency histogram buckets. The last
+// bucket is unbounded and counts everything above the last bound.
+var latencyBucketBoundsMs = []float64{
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500,
+	1000, 2500, 5000, 10000, 30000, 60000,
+}
+
+// Histogram of latencies with fixed buckets, percentiles are estimated by
+// linear interpolation within the bucket they fall in. Exported fields so
+// that it serializes along with TaskStats.
+type LatencyHistogram struct {
+	Count  int64     `json:"count"`
+	SumMs  float64   `json:"sum_ms"`
+	MaxMs  float64   `json:"max_ms"`
+	P50Ms  float64   `json:"p50_ms"`
+	P95Ms  float64   `json:"p95_ms"`
+	P99Ms  float64   `json:"p99_ms"`
+	Bounds []float64 `json:"bounds_ms"`
+
+	// Counts per bucket, one more than the bounds.
+	Counts []int64 `json:"counts"`
+}
+
+func newLatencyHistogram() LatencyHistogram {
+	return LatencyHistogram{
+		Bounds: latencyBucketBoundsMs,
+		Counts: make([]int64, len(latencyBucketBoundsMs)+1),
+	}
+}
+
+// Caller holds the stats lock.
+func (h *LatencyHistogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms < 0 {
+		ms = 0
+	}
+	i := 0
+	for i < len(h.Bounds) && ms > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.SumMs += ms
+	if ms > h.MaxMs {
+		h.MaxMs = ms
+	}
+	h.P50Ms = h.Percentile(0.50)
+	h.P95Ms = h.Percentile(0.95)
+	h.P99Ms = h.Percentile(0.99)
+}
+
+// Estimated latency in milliseconds below which the given fraction, between
+// 0 and 1, of observations fall. Zero if nothing is observed yet.
+func (h *LatencyHistogram) Percentile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	var cumulative int64
+	for i, c := range h.Counts {
+		if c == 0 || float64(cumulative+c) < rank {
+			cumulative += c
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		upper := h.MaxMs
+		if i < len(h.Bounds) && h.Bounds[i] < upper {
+			upper = h.Bounds[i]
+		}
+		if upper < lower {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(c)
+	}
+	return h.MaxMs
+}
+
+func (h *LatencyHistogram) MeanMs() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.SumMs / float64(h.Count)
+}
+
+// Blocking and async counts of the same thing.
+type KindCounts struct {
+	Blocking int `json:"blocking"`
+	Async    int `json:"async"`
+}
+
+func (kc *KindCounts) add(blocking bool) {
+	if blocking {
+		kc.Blocking++
+	} else {
+		kc.Async++
+	}
+}
+
+func (kc KindCounts) Total() int {
+	return kc.Blocking + kc.Async
+}
+
+// Number of one second slots in the sliding window.
+const windowSlots = 60
+
+// Tasks ended and time executors were busy, per second over the last minute.
+// Each slot is stamped with the second it accounts for so that stale slots
+// are recognized and reset lazily. There is one more slot than the window
+// for the second in progress.
+type slidingWindow struct {
+	slots [windowSlots + 1]windowSlot
+}
+
+type windowSlot struct {
+	second int64
+	ended  int
+	busy   map[int]time.Duration // keyed by executor id
+}
+
+// Caller holds the stats lock.
+func (w *slidingWindow) slot(sec int64) *windowSlot {
+	s := &w.slots[sec%int64(len(w.slots))]
+	if s.second != sec {
+		s.second = sec
+		s.ended = 0
+		s.busy = nil
+	}
+	return s
+}
+
+// Account the task which ended at the given time, having run on the executor
+// from the start time; a zero start means the task never ran on an executor.
+func (w *slidingWindow) record(executor int, start time.Time, end time.Time) {
+	w.slot(end.Unix()).ended++
+	if start.IsZero() || executor < 0 {
+		return
+	}
+	// spread the busy time over the seconds the execution spans, within
+	// the window
+	from := start
+	if earliest := end.Add(-windowSlots * time.Second); from.Before(earliest) {
+		from = earliest
+	}
+	for from.Before(end) {
+		next := time.Unix(from.Unix()+1, 0)
+		if next.After(end) {
+			next = end
+		}
+		s := w.slot(from.Unix())
+		if s.busy == nil {
+			s.busy = make(map[int]time.Duration)
+		}
+		s.busy[executor] += next.Sub(from)
+		from = next
+	}
+}
+
+// Tasks ended per second over the given number of most recent complete
+// seconds, not counting the current one which is still in progress.
+func (w *slidingWindow) throughput(now time.Time, seconds int) float64 {
+	current := now.Unix()
+	ended := 0
+	for sec := current - int64(seconds); sec < current; sec++ {
+		if s := &w.slots[sec%int64(len(w.slots))]; s.second == sec {
+			ended += s.ended
+		}
+	}
+	return float64(ended) / float64(seconds)
+}
+
+// Fraction of the window, or of the time since the given start if shorter,
+// each executor spent executing tasks.
+func (w *slidingWindow) utilization(now time.Time, since time.Time) map[int]float64 {
+	current := now.Unix()
+	span := time.Duration(windowSlots) * time.Second
+	if up := now.Sub(since); up < span {
+		span = up
+	}
+	busy := make(map[int]time.Duration)
+	for sec := current - windowSlots + 1; sec <= current; sec++ {
+		if s := &w.slots[sec%int64(len(w.slots))]; s.second == sec {
+			for e, d := range s.busy {
+				busy[e] += d
+			}
+		}
+	}
+	result := make(map[int]float64, len(busy))
+	for e, d := range busy {
+		u := 1.0
+		if d < span {
+			u = float64(d) / float64(span)
+		}
+		result[e] = u
+	}
+	return result
+}
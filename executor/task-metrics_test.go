@@ -0,0 +1,63 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newLatencyHistogram()
+	assert.Zero(h.Percentile(0.5))
+	// 90 fast ones between 1 and 2.5 ms, 10 slow ones between 50 and 100 ms
+	for i := 0; i < 90; i++ {
+		h.observe(2 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(80 * time.Millisecond)
+	}
+	assert.Equal(int64(100), h.Count)
+	assert.Equal(80.0, h.MaxMs)
+	assert.InDelta(9.8, h.MeanMs(), 0.001)
+	assert.True(h.P50Ms > 1 && h.P50Ms <= 2.5, "p50 %v", h.P50Ms)
+	assert.True(h.P95Ms > 50 && h.P95Ms <= 80, "p95 %v", h.P95Ms)
+	assert.True(h.P99Ms >= h.P95Ms && h.P99Ms <= 80, "p99 %v", h.P99Ms)
+
+	// beyond the last bound, estimates never exceed the maximum
+	h.observe(2 * time.Minute)
+	assert.Equal(int64(1), h.Counts[len(h.Counts)-1])
+	assert.LessOrEqual(h.Percentile(1), h.MaxMs)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	var w slidingWindow
+	now := time.Unix(1000000, 0)
+	// executor 1 busy for 3 seconds, the task ended 2 seconds ago
+	w.record(1, now.Add(-5*time.Second), now.Add(-2*time.Second))
+	// executor 2 ran 10 short tasks last second
+	for i := 0; i < 10; i++ {
+		w.record(2, now.Add(-900*time.Millisecond), now.Add(-800*time.Millisecond))
+	}
+	// a task which never reached an executor
+	w.record(-1, time.Time{}, now.Add(-time.Second))
+
+	assert.InDelta(1.2, w.throughput(now, 10), 0.001)
+	assert.InDelta(12.0/60, w.throughput(now, windowSlots), 0.001)
+
+	u := w.utilization(now, now.Add(-time.Hour))
+	assert.InDelta(3.0/60, u[1], 0.001)
+	assert.InDelta(1.0/60, u[2], 0.001)
+	assert.Len(u, 2)
+
+	// a minute later all of it is out of the window
+	later := now.Add(2 * time.Minute)
+	assert.Zero(w.throughput(later, windowSlots))
+	assert.Empty(w.utilization(later, now))
+}
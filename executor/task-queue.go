@@ -0,0 +1,252 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority of tasks which do not implement PrioritizedTask.
+const DefaultTaskPriority = 0
+
+// Optional interface a task can implement to be served ahead of (or after)
+// other tasks queued on the same executor. Higher number means higher
+// priority; tasks of the same priority are served in the order of arrival.
+type PrioritizedTask interface {
+	Task
+
+	GetPriority() int
+}
+
+// Priority of the given task, looking through any wrapping done internally.
+func taskPriority(tsk Task) int {
+	if pt, ok := unwrapTask(tsk).(PrioritizedTask); ok {
+		return pt.GetPriority()
+	}
+	return DefaultTaskPriority
+}
+
+// The client task behind any internal wrapper.
+func unwrapTask(tsk Task) Task {
+	if ct, ok := tsk.(*contextTask); ok {
+		return ct.Task
+	}
+	return tsk
+}
+
+type queuedTask struct {
+	task Task
+	key  int64  // higher key is served first
+	seq  uint64 // arrival order, to break ties
+}
+
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int {
+	return len(h)
+}
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].key == h[j].key {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].key > h[j].key
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *taskHeap) Push(x any) {
+	*h = append(*h, x.(*queuedTask))
+}
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	n := len(old)
+	qt := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return qt
+}
+
+// Bounded priority queue of tasks waiting for an executor.
+//
+// To keep low priority tasks from starving, a waiting task gains one
+// priority level for every aging interval it spends in the queue. Since all
+// waiting tasks age at the same rate, comparing effective priorities
+//
+//	p1 + (now - t1) / aging   vs   p2 + (now - t2) / aging
+//
+// is the same as comparing p1 * aging - t1 with p2 * aging - t2 which does
+// not depend on 'now'. So the ordering key is computed once at insertion and
+// a plain heap does the job.
+//
+// Waiters - for space or for a task - wait on a channel which is closed and
+// replaced on every change of the queue, so no wake up is ever lost and the
+// wait can be abandoned when the context is done.
+type taskQueue struct {
+	mux      sync.Mutex
+	tasks    taskHeap
+	capacity int
+	aging    time.Duration // zero disables aging
+	seq      uint64
+	closed   bool
+	draining bool // no more tasks are accepted, but queued ones are still served
+	changed  chan struct{}
+	listener func() // invoked, outside the lock, whenever a task is added or the queue is closed
+}
+
+func newTaskQueue(capacity int, aging time.Duration) *taskQueue {
+	q := new(taskQueue)
+	q.capacity = capacity
+	q.aging = aging
+	q.changed = make(chan struct{})
+	return q
+}
+
+// caller holds the lock
+func (q *taskQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+func (q *taskQueue) key(tsk Task) int64 {
+	p := int64(taskPriority(tsk))
+	if q.aging <= 0 {
+		return p
+	}
+	return p*int64(q.aging) - time.Now().UnixNano()
+}
+
+// Add the task if there is space. If the queue is full and wait is true, it
+// waits until there is space or the context is done. Returns false along
+// with no error when the queue is full and we are not waiting.
+func (q *taskQueue) put(ctx context.Context, tsk Task, wait bool) (bool, error) {
+	for {
+		q.mux.Lock()
+		if q.closed || q.draining {
+			q.mux.Unlock()
+			return false, ErrShutdown
+		}
+		if q.tasks.Len() < q.capacity {
+			q.seq++
+			heap.Push(&q.tasks, &queuedTask{task: tsk, key: q.key(tsk), seq: q.seq})
+			q.notifyLocked()
+			q.mux.Unlock()
+			q.notifyListener()
+			return true, nil
+		}
+		ch := q.changed
+		q.mux.Unlock()
+		if !wait {
+			return false, nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// Remove and return the task to be served next, waiting for one if the queue
+// is empty. Returns false when the queue is closed or fully drained.
+func (q *taskQueue) take() (Task, bool) {
+	for {
+		q.mux.Lock()
+		if q.closed {
+			q.mux.Unlock()
+			return nil, false
+		}
+		if q.tasks.Len() > 0 {
+			qt := heap.Pop(&q.tasks).(*queuedTask)
+			q.notifyLocked()
+			q.mux.Unlock()
+			return qt.task, true
+		}
+		if q.draining {
+			q.mux.Unlock()
+			return nil, false
+		}
+		ch := q.changed
+		q.mux.Unlock()
+		<-ch
+	}
+}
+
+// Remove and return the task to be served next without waiting. The second
+// value is false if there is no task, the third one is true if the queue is
+// closed or fully drained.
+func (q *taskQueue) poll() (Task, bool, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.closed {
+		return nil, false, true
+	}
+	if q.tasks.Len() == 0 {
+		return nil, false, q.draining
+	}
+	qt := heap.Pop(&q.tasks).(*queuedTask)
+	q.notifyLocked()
+	return qt.task, true, false
+}
+
+// Remove and return the task to be served next, without waiting and even if
+// the queue is draining; to make space for another task.
+func (q *taskQueue) evictNext() (Task, bool) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if q.tasks.Len() == 0 {
+		return nil, false
+	}
+	qt := heap.Pop(&q.tasks).(*queuedTask)
+	q.notifyLocked()
+	return qt.task, true
+}
+
+func (q *taskQueue) notifyListener() {
+	if q.listener != nil {
+		q.listener()
+	}
+}
+
+func (q *taskQueue) len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.tasks.Len()
+}
+
+// Stop accepting tasks; the ones already in the queue are still served after
+// which the queue reports itself closed to consumers.
+func (q *taskQueue) drain() {
+	q.mux.Lock()
+	if !q.draining {
+		q.draining = true
+		q.notifyLocked()
+	}
+	q.mux.Unlock()
+	q.notifyListener()
+}
+
+// Close the queue; waiters are released and tasks still in the queue, which
+// will not be served, are removed and returned in the order they would have
+// been served.
+func (q *taskQueue) close() []Task {
+	q.mux.Lock()
+	var dropped []Task
+	for q.tasks.Len() > 0 {
+		dropped = append(dropped, heap.Pop(&q.tasks).(*queuedTask).task)
+	}
+	if !q.closed {
+		q.closed = true
+		q.notifyLocked()
+	}
+	q.mux.Unlock()
+	q.notifyListener()
+	return dropped
+}
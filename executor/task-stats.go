@@ -19,6 +19,38 @@ type TaskStats struct {
 	BlockingTasksSubmitted int       `json:"blocking_tasks_submitted"`
 	AsyncTasksSubmitted    int       `json:"async_tasks_submitted"`
 	TasksInExecution       int       `json:"tasks_in_execution"`
+	TasksScheduled         int       `json:"tasks_scheduled"`
+	ScheduledTasksPending  int       `json:"scheduled_tasks_pending"`
+	TasksStolen            int       `json:"tasks_stolen"`
+	BlockingTasksStolen    int       `json:"blocking_tasks_stolen"`
+	AsyncTasksStolen       int       `json:"async_tasks_stolen"`
+	TasksPanicked          int       `json:"tasks_panicked"`
+	TasksTimedOut          int       `json:"tasks_timed_out"`
+	TaskRetries            int       `json:"task_retries"`
+
+	// Outcome of the tasks, split by blocking and async. Rejected are the
+	// tasks not accepted, or discarded, as per the rejection policy.
+	Completed KindCounts `json:"completed"`
+	Failed    KindCounts `json:"failed"`
+	Cancelled KindCounts `json:"cancelled"`
+	Rejected  KindCounts `json:"rejected"`
+	TimedOut  KindCounts `json:"timed_out"`
+
+	// Time from submission to the start of the latest attempt and time the
+	// executor took for it, of the tasks which ran on an executor.
+	QueueWait LatencyHistogram `json:"queue_wait"`
+	Execution LatencyHistogram `json:"execution"`
+
+	// Tasks ended per second, refreshed when the stats are serialized.
+	Throughput10s float64 `json:"throughput_10s"`
+	Throughput1m  float64 `json:"throughput_1m"`
+
+	// Fraction of the last minute each executor, keyed by its id, was busy
+	// executing tasks; refreshed when the stats are serialized. Executors
+	// which did not execute anything in the last minute are absent.
+	ExecutorUtilization map[int]float64 `json:"executor_utilization"`
+
+	window slidingWindow
 }
 
 // Create a new task stats (on purpose with lesser scope, only executor
@@ -26,9 +58,13 @@ type TaskStats struct {
 func newTaskStats() *TaskStats {
 	ts := TaskStats{}
 	ts.UpSinceWhen = time.Now()
+	ts.QueueWait = newLatencyHistogram()
+	ts.Execution = newLatencyHistogram()
 	return &ts
 }
 
+// A task made it to an executor, or is run by the submitter. Submissions are
+// counted only once they are through so that the counts never go down.
 func (ts *TaskStats) taskSubmitted(blocking bool) {
 	ts.Lock()
 	if blocking {
@@ -37,13 +73,94 @@ func (ts *TaskStats) taskSubmitted(blocking bool) {
 		ts.AsyncTasksSubmitted++
 	}
 	ts.TotalTasksSubmitted++
+	ts.Unlock()
+}
+
+// A task is being handed over to an executor. It is in execution from then
+// on, as the executor may respond right away, till it is done or the hand
+// over fails.
+func (ts *TaskStats) taskHandedOver() {
+	ts.Lock()
 	ts.TasksInExecution++
 	ts.Unlock()
 }
 
-func (ts *TaskStats) taskDone(blocking bool) {
+// The task being handed over did not make it to an executor after all.
+func (ts *TaskStats) handOverFailed() {
+	ts.Lock()
+	ts.TasksInExecution--
+	ts.Unlock()
+}
+
+// A submitted task ended, the info carries its final state and timestamps.
+func (ts *TaskStats) taskDone(info TaskInfo) {
 	ts.Lock()
+	defer ts.Unlock()
 	ts.TasksInExecution--
+	status := 0
+	if info.Response != nil {
+		status = info.Response.Status
+	}
+	switch {
+	case status == TaskStatusDiscarded:
+		ts.Rejected.add(info.Blocking)
+	case info.State == TaskCompleted:
+		ts.Completed.add(info.Blocking)
+	case info.State == TaskCancelled:
+		ts.Cancelled.add(info.Blocking)
+	case info.State == TaskTimedOut:
+		ts.TimedOut.add(info.Blocking)
+		ts.TasksTimedOut++
+	default:
+		ts.Failed.add(info.Blocking)
+		if status == TaskStatusPanicked {
+			ts.TasksPanicked++
+		}
+	}
+	if !info.StartedAt.IsZero() {
+		ts.QueueWait.observe(info.StartedAt.Sub(info.SubmittedAt))
+		ts.Execution.observe(info.EndedAt.Sub(info.StartedAt))
+	}
+	ts.window.record(info.Executor, info.StartedAt, info.EndedAt)
+}
+
+// A task was not accepted, the rejection policy took care of it.
+func (ts *TaskStats) taskRejected(blocking bool) {
+	ts.Lock()
+	ts.Rejected.add(blocking)
+	ts.Unlock()
+}
+
+// A task is handed over to the scheduler, periodic tasks are counted once.
+func (ts *TaskStats) taskScheduled() {
+	ts.Lock()
+	ts.TasksScheduled++
+	ts.Unlock()
+}
+
+// How many scheduled tasks are waiting for their turn to run.
+func (ts *TaskStats) setPendingScheduled(n int) {
+	ts.Lock()
+	ts.ScheduledTasksPending = n
+	ts.Unlock()
+}
+
+// An idle executor took over a task queued on a sibling executor.
+func (ts *TaskStats) taskStolen(blocking bool) {
+	ts.Lock()
+	if blocking {
+		ts.BlockingTasksStolen++
+	} else {
+		ts.AsyncTasksStolen++
+	}
+	ts.TasksStolen++
+	ts.Unlock()
+}
+
+// A failed task is going to be executed once more.
+func (ts *TaskStats) taskRetried() {
+	ts.Lock()
+	ts.TaskRetries++
 	ts.Unlock()
 }
 
@@ -51,6 +168,10 @@ func (ts *TaskStats) byteArray() []byte {
 	var result []byte
 	ts.Lock()
 	defer ts.Unlock()
+	now := time.Now()
+	ts.Throughput10s = ts.window.throughput(now, 10)
+	ts.Throughput1m = ts.window.throughput(now, windowSlots)
+	ts.ExecutorUtilization = ts.window.utilization(now, ts.UpSinceWhen)
 	result, err := json.Marshal(ts)
 	if err != nil {
 		util.Log(fmt.Sprintf("Error in marshalling TaskStats: %v", err))
@@ -0,0 +1,57 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"time"
+)
+
+// Optional interface a task can implement to bound its own execution time,
+// overriding the default timeout configured for executors. Zero or negative
+// timeout means the task can run as long as it takes.
+type TimedTask interface {
+	Task
+
+	GetTimeout() time.Duration
+}
+
+// Execution timeout for the given task, falling back to the executor default.
+func taskTimeout(tsk Task, defaultTimeout time.Duration) time.Duration {
+	if tt, ok := unwrapTask(tsk).(TimedTask); ok {
+		return tt.GetTimeout()
+	}
+	return defaultTimeout
+}
+
+// Execute the task under a watchdog if it has a timeout. The task runs in its
+// own go routine with a context which is cancelled once the timeout expires;
+// at that point the executor reports a timed out response and moves on to the
+// next task. In effect the hung go routine is replaced by a fresh one and
+// whatever it returns later is discarded.
+func (t *thread) execute(tsk Task) Response {
+	timeout := taskTimeout(tsk, t.taskTimeout)
+	if timeout <= 0 {
+		return executeRecovering(tsk, t.panicHandler, t.handler)
+	}
+	parent := context.Background()
+	if ct, ok := tsk.(*contextTask); ok {
+		parent = ct.ctx
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	timed := &contextTask{Task: unwrapTask(tsk), ctx: ctx}
+	done := make(chan Response, 1)
+	go func() {
+		done <- executeRecovering(timed, t.panicHandler, t.handler)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-done:
+		return resp
+	case <-timer.C:
+		return *TimedOutResponse(tsk.GetId(), timeout)
+	}
+}
@@ -3,6 +3,8 @@
 
 package executor
 
+import "context"
+
 // Basic interface client of executor module should implement so as to get the
 // work done. It has standard id and core execute methods. Also it needs to
 // carry the channel with it on which the result of execution will be reported.
@@ -18,3 +20,46 @@ type Task interface {
 
 	IsBlocking() bool
 }
+
+// Optional interface a task can implement to receive the context it was
+// submitted with, say to abandon the work when the caller cancels it. When
+// implemented, executors invoke ExecuteContext instead of Execute.
+type ContextTask interface {
+	Task
+
+	ExecuteContext(ctx context.Context) Response
+}
+
+// Wraps a client task with the context it was submitted with so that an
+// executor can skip the task when the caller has already given up on it
+// while the task was sitting in the queue.
+type contextTask struct {
+	Task
+	ctx context.Context
+}
+
+// Returns true if the given task was submitted with a context which is done.
+func isCancelled(tsk Task) bool {
+	if ct, ok := tsk.(*contextTask); ok {
+		return ct.ctx.Err() != nil
+	}
+	return false
+}
+
+// Execute the task through the handler, unless it is already cancelled,
+// handing over the submission context to tasks which are interested in it.
+// Nil handler means the task is invoked directly.
+func executeTask(tsk Task, h Handler) Response {
+	if isCancelled(tsk) {
+		return *CancelledResponse(tsk.GetId())
+	}
+	ctx := context.Background()
+	if ct, ok := tsk.(*contextTask); ok {
+		ctx = ct.ctx
+		tsk = ct.Task
+	}
+	if h == nil {
+		h = invokeTask
+	}
+	return h(ctx, tsk)
+}
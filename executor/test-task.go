@@ -4,8 +4,10 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,7 +15,7 @@ const TestTaskExecDurationLowerLimit = 8
 const TestTaskExecDurationUpperLimit = 128
 const TestTaskDurationRange = TestTaskExecDurationUpperLimit - TestTaskExecDurationLowerLimit
 
-var taskIdCounter int
+var taskIdCounter int64
 
 type TestTask struct {
 	id           int
@@ -67,7 +69,7 @@ func (tt *TestTask) IsBlocking() bool {
 }
 
 func SetupTestTask() {
-	taskIdCounter = 0
+	atomic.StoreInt64(&taskIdCounter, 0)
 }
 
 func NewTestTask(ed int) *TestTask {
@@ -76,16 +78,161 @@ func NewTestTask(ed int) *TestTask {
 
 func NewBlockingTestTask(ed int, blocking bool) *TestTask {
 	tt := new(TestTask)
-	taskIdCounter = +nextTaskId()
-	tt.id = taskIdCounter
+	tt.id = nextTaskId()
 	tt.blocking = blocking
 	tt.execDuration = ed
 	return tt
 }
 
+// Test task which also carries a priority.
+type PrioritizedTestTask struct {
+	TestTask
+	priority int
+}
+
+func (ptt *PrioritizedTestTask) GetPriority() int {
+	return ptt.priority
+}
+
+func NewPrioritizedTestTask(ed int, blocking bool, priority int) *PrioritizedTestTask {
+	ptt := new(PrioritizedTestTask)
+	ptt.TestTask = *NewBlockingTestTask(ed, blocking)
+	ptt.priority = priority
+	return ptt
+}
+
+// Test task which panics when executed.
+type PanickingTestTask struct {
+	TestTask
+}
+
+func (ptt *PanickingTestTask) Execute() Response {
+	panic(fmt.Sprintf("task %d cannot go on", ptt.id))
+}
+
+func NewPanickingTestTask(blocking bool) *PanickingTestTask {
+	ptt := new(PanickingTestTask)
+	ptt.TestTask = *NewBlockingTestTask(0, blocking)
+	return ptt
+}
+
+// Panics with nil, which recover does not tell apart from no panic.
+type NilPanickingTestTask struct {
+	TestTask
+}
+
+func (nptt *NilPanickingTestTask) Execute() Response {
+	panic(nil)
+}
+
+func NewNilPanickingTestTask(blocking bool) *NilPanickingTestTask {
+	nptt := new(NilPanickingTestTask)
+	nptt.TestTask = *NewBlockingTestTask(0, blocking)
+	return nptt
+}
+
+// Test task with its own execution timeout.
+type TimedTestTask struct {
+	TestTask
+	timeout time.Duration
+}
+
+func (ttt *TimedTestTask) GetTimeout() time.Duration {
+	return ttt.timeout
+}
+
+func NewTimedTestTask(ed int, blocking bool, timeout time.Duration) *TimedTestTask {
+	ttt := new(TimedTestTask)
+	ttt.TestTask = *NewBlockingTestTask(ed, blocking)
+	ttt.timeout = timeout
+	return ttt
+}
+
+// Test task which fails the given number of times before it succeeds.
+type FlakyTestTask struct {
+	TestTask
+	failures int32
+	policy   *RetryPolicy
+}
+
+func (ftt *FlakyTestTask) Execute() Response {
+	if atomic.AddInt32(&ftt.failures, -1) >= 0 {
+		resp := NewResponse(ftt.id)
+		resp.Status = TaskStatusCompletedFailed
+		resp.Errors = []error{errors.New("flaky failure")}
+		return *resp
+	}
+	return ftt.TestTask.Execute()
+}
+
+func (ftt *FlakyTestTask) GetRetryPolicy() *RetryPolicy {
+	return ftt.policy
+}
+
+func NewFlakyTestTask(failures int, blocking bool, policy *RetryPolicy) *FlakyTestTask {
+	ftt := new(FlakyTestTask)
+	ftt.TestTask = *NewBlockingTestTask(10, blocking)
+	ftt.failures = int32(failures)
+	ftt.policy = policy
+	return ftt
+}
+
+// Test task which remembers responses of the tasks it depends on in a Dag.
+type UpstreamTestTask struct {
+	TestTask
+	upstream map[int]Response
+}
+
+func (utt *UpstreamTestTask) ReceiveUpstream(responses map[int]Response) {
+	utt.upstream = responses
+}
+
+func NewUpstreamTestTask(ed int, blocking bool) *UpstreamTestTask {
+	utt := new(UpstreamTestTask)
+	utt.TestTask = *NewBlockingTestTask(ed, blocking)
+	return utt
+}
+
+// Test task which runs till the test releases it, to keep it in flight for
+// as long as needed regardless of how slow the machine is.
+type HeldTestTask struct {
+	TestTask
+	release <-chan struct{}
+}
+
+func (htt *HeldTestTask) Execute() Response {
+	<-htt.release
+	return htt.TestTask.Execute()
+}
+
+func NewHeldTestTask(blocking bool, release <-chan struct{}) *HeldTestTask {
+	htt := new(HeldTestTask)
+	htt.TestTask = *NewBlockingTestTask(0, blocking)
+	htt.release = release
+	return htt
+}
+
+// Test task which invokes the probe when it is executed.
+type ProbeTestTask struct {
+	TestTask
+	probe func()
+}
+
+func (ptt *ProbeTestTask) Execute() Response {
+	ptt.probe()
+	return ptt.TestTask.Execute()
+}
+
+func NewProbeTestTask(blocking bool, probe func()) *ProbeTestTask {
+	ptt := new(ProbeTestTask)
+	ptt.TestTask = *NewBlockingTestTask(0, blocking)
+	ptt.probe = probe
+	return ptt
+}
+
+// Safe to call from concurrent go routines.
 func nextTaskId() int {
-	taskIdCounter += 1
-	return taskIdCounter
+	return int(atomic.AddInt64(&taskIdCounter, 1))
 }
 
 func RandomTestTaskExecTime() int {
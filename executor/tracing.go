@@ -0,0 +1,290 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tracer is notified along the life of every task submitted through the
+// dispatcher, loosely following OpenTelemetry. TaskSubmitted is invoked first
+// with the caller's context and the context it returns, typically carrying a
+// span started under the caller's span, is handed to the rest of the hooks of
+// that task; it is also the context the task is executed with. A retried task
+// goes through dequeue, start and end once per attempt. Hooks are invoked
+// from executor and dispatcher go routines, so they must be quick and safe
+// for concurrent use.
+type Tracer interface {
+	TaskSubmitted(ctx context.Context, tsk Task, submissionId uint64) context.Context
+
+	// An executor took the task out of the queue.
+	TaskDequeued(ctx context.Context, tsk Task, executor int)
+
+	TaskStarted(ctx context.Context, tsk Task, executor int)
+
+	TaskEnded(ctx context.Context, tsk Task, executor int, resp Response)
+
+	// Final response is handed over to the caller; the last hook invoked.
+	ResponseDelivered(ctx context.Context, resp Response)
+}
+
+// What executors report about a task.
+type taskEvent int
+
+const (
+	taskDequeued taskEvent = iota
+	taskStarted
+	taskEnded
+)
+
+type TraceId [16]byte
+type SpanId [8]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanId) IsValid() bool {
+	return id != SpanId{}
+}
+
+type SpanStatus int
+
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusOk
+	SpanStatusError
+)
+
+// Something which happened at a point of time during a span.
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]string
+}
+
+// Snapshot of a span, handed to the processor when the span ends.
+type SpanData struct {
+	TraceId       TraceId
+	SpanId        SpanId
+	ParentSpanId  SpanId // invalid for a root span
+	Name          string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]string
+	Events        []SpanEvent
+	Status        SpanStatus
+	StatusMessage string
+}
+
+// Span in progress; safe for concurrent use.
+type Span struct {
+	mux     sync.Mutex
+	data    SpanData
+	ended   bool
+	attempt *Span // execution span of the current attempt of a task
+	tracer  *SpanTracer
+}
+
+func (s *Span) TraceId() TraceId {
+	return s.data.TraceId
+}
+
+func (s *Span) SpanId() SpanId {
+	return s.data.SpanId
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	s.mux.Lock()
+	s.data.Attributes[key] = value
+	s.mux.Unlock()
+}
+
+// Attributes are given as key, value pairs.
+func (s *Span) AddEvent(name string, attributes ...string) {
+	ev := SpanEvent{Name: name, Time: time.Now(), Attributes: make(map[string]string)}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		ev.Attributes[attributes[i]] = attributes[i+1]
+	}
+	s.mux.Lock()
+	s.data.Events = append(s.data.Events, ev)
+	s.mux.Unlock()
+}
+
+func (s *Span) SetStatus(status SpanStatus, message string) {
+	s.mux.Lock()
+	s.data.Status = status
+	s.data.StatusMessage = message
+	s.mux.Unlock()
+}
+
+// End the span and hand it over to the processor; only the first call counts.
+func (s *Span) End() {
+	s.mux.Lock()
+	if s.ended {
+		s.mux.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.snapshot()
+	s.mux.Unlock()
+	if s.tracer.onEnd != nil {
+		s.tracer.onEnd(data)
+	}
+}
+
+// caller holds the lock
+func (s *Span) snapshot() SpanData {
+	data := s.data
+	data.Attributes = make(map[string]string, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	data.Events = append([]SpanEvent(nil), s.data.Events...)
+	return data
+}
+
+type spanContextKey struct{}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// Span carried by the context, nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// Tracer building spans: one span named "task" from submission till the
+// response is delivered, with a child span named "execute" for every attempt.
+// Spans nest under the span in the caller's context, if any, which can be
+// started with StartSpan. Finished spans are handed to the processor given.
+type SpanTracer struct {
+	onEnd func(SpanData)
+}
+
+func NewSpanTracer(onEnd func(SpanData)) *SpanTracer {
+	return &SpanTracer{onEnd: onEnd}
+}
+
+// Start a span as child of the span in the context, if any, and return the
+// context carrying the new span.
+func (st *SpanTracer) StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{tracer: st}
+	s.data.Name = name
+	s.data.Start = time.Now()
+	s.data.Attributes = make(map[string]string)
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.data.TraceId = parent.TraceId()
+		s.data.ParentSpanId = parent.SpanId()
+	} else {
+		rand.Read(s.data.TraceId[:])
+	}
+	rand.Read(s.data.SpanId[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+func (st *SpanTracer) TaskSubmitted(ctx context.Context, tsk Task, submissionId uint64) context.Context {
+	ctx, s := st.StartSpan(ctx, "task")
+	s.SetAttribute("task.id", strconv.Itoa(tsk.GetId()))
+	s.SetAttribute("task.submission_id", strconv.FormatUint(submissionId, 10))
+	s.SetAttribute("task.blocking", strconv.FormatBool(tsk.IsBlocking()))
+	return ctx
+}
+
+func (st *SpanTracer) TaskDequeued(ctx context.Context, tsk Task, executor int) {
+	if s := SpanFromContext(ctx); s != nil {
+		s.AddEvent("dequeued", "executor.id", strconv.Itoa(executor))
+	}
+}
+
+func (st *SpanTracer) TaskStarted(ctx context.Context, tsk Task, executor int) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+	_, attempt := st.StartSpan(ctx, "execute")
+	attempt.SetAttribute("executor.id", strconv.Itoa(executor))
+	s.mux.Lock()
+	s.attempt = attempt
+	s.mux.Unlock()
+}
+
+func (st *SpanTracer) TaskEnded(ctx context.Context, tsk Task, executor int, resp Response) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+	s.mux.Lock()
+	attempt := s.attempt
+	s.attempt = nil
+	s.mux.Unlock()
+	if attempt != nil {
+		setResponseStatus(attempt, resp)
+		attempt.End()
+	}
+}
+
+func (st *SpanTracer) ResponseDelivered(ctx context.Context, resp Response) {
+	if s := SpanFromContext(ctx); s != nil {
+		s.SetAttribute("task.attempts", strconv.Itoa(resp.Attempts))
+		setResponseStatus(s, resp)
+		s.End()
+	}
+}
+
+func setResponseStatus(s *Span, resp Response) {
+	s.SetAttribute("task.status", strconv.Itoa(resp.Status))
+	if resp.Status == TaskStatusCompletedSuccessfully {
+		s.SetStatus(SpanStatusOk, "")
+	} else {
+		s.SetStatus(SpanStatusError, finalState(resp.Status).String())
+	}
+}
+
+// Tracer keeping finished spans in memory, meant for tests.
+type SpanRecorder struct {
+	*SpanTracer
+	mux   sync.Mutex
+	spans []SpanData
+}
+
+func NewSpanRecorder() *SpanRecorder {
+	sr := new(SpanRecorder)
+	sr.SpanTracer = NewSpanTracer(sr.record)
+	return sr
+}
+
+func (sr *SpanRecorder) record(data SpanData) {
+	sr.mux.Lock()
+	sr.spans = append(sr.spans, data)
+	sr.mux.Unlock()
+}
+
+// Finished spans in the order they ended.
+func (sr *SpanRecorder) Spans() []SpanData {
+	sr.mux.Lock()
+	defer sr.mux.Unlock()
+	return append([]SpanData(nil), sr.spans...)
+}
+
+func (sr *SpanRecorder) Reset() {
+	sr.mux.Lock()
+	sr.spans = nil
+	sr.mux.Unlock()
+}
@@ -0,0 +1,125 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTracerSpans(t *testing.T) {
+	assert := assert.New(t)
+	recorder := NewSpanRecorder()
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.Tracer = recorder
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	// spans of the task nest under the caller's span
+	ctx, parent := recorder.StartSpan(context.Background(), "request")
+	task := NewBlockingTestTask(100, true)
+	err, resp := testEs.SubmitContext(ctx, task)
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, resp.Status)
+	parent.End()
+
+	spans := recorder.Spans()
+	if !assert.Len(spans, 3) {
+		return
+	}
+	execute, taskSpan, request := spans[0], spans[1], spans[2]
+	assert.Equal("execute", execute.Name)
+	assert.Equal("task", taskSpan.Name)
+	assert.Equal("request", request.Name)
+	assert.Equal(request.TraceId, taskSpan.TraceId)
+	assert.Equal(request.TraceId, execute.TraceId)
+	assert.False(request.ParentSpanId.IsValid())
+	assert.Equal(request.SpanId, taskSpan.ParentSpanId)
+	assert.Equal(taskSpan.SpanId, execute.ParentSpanId)
+
+	assert.Equal(strconv.Itoa(task.GetId()), taskSpan.Attributes["task.id"])
+	assert.Equal(strconv.FormatUint(resp.SubmissionId, 10), taskSpan.Attributes["task.submission_id"])
+	assert.Equal("true", taskSpan.Attributes["task.blocking"])
+	assert.Equal(SpanStatusOk, taskSpan.Status)
+	assert.Equal(SpanStatusOk, execute.Status)
+	if assert.Len(taskSpan.Events, 1) {
+		assert.Equal("dequeued", taskSpan.Events[0].Name)
+		assert.Equal(execute.Attributes["executor.id"], taskSpan.Events[0].Attributes["executor.id"])
+	}
+	assert.False(execute.Start.Before(taskSpan.Start))
+	assert.False(taskSpan.End.Before(execute.End))
+}
+
+func TestTracerRetriedTask(t *testing.T) {
+	assert := assert.New(t)
+	recorder := NewSpanRecorder()
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.Tracer = recorder
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoffMs: 1}
+	err, f := testEs.SubmitAsync(context.Background(), NewFlakyTestTask(2, false, policy))
+	assert.Nil(err)
+	assert.Equal(TaskStatusCompletedSuccessfully, f.Get().Status)
+
+	var spans []SpanData
+	assert.Eventually(func() bool {
+		spans = recorder.Spans()
+		return len(spans) == 4
+	}, time.Second, time.Millisecond)
+	taskSpan := spans[len(spans)-1]
+	assert.Equal("task", taskSpan.Name)
+	assert.Equal("3", taskSpan.Attributes["task.attempts"])
+	assert.Len(taskSpan.Events, 3)
+	statuses := []SpanStatus{}
+	for _, s := range spans[:3] {
+		assert.Equal("execute", s.Name)
+		assert.Equal(taskSpan.SpanId, s.ParentSpanId)
+		statuses = append(statuses, s.Status)
+	}
+	assert.Equal([]SpanStatus{SpanStatusError, SpanStatusError, SpanStatusOk}, statuses)
+}
+
+func TestOtlpExporter(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	exporter := NewOtlpExporter("orders", NewJsonLinesSpanSink(&buf))
+	cfg := createCommonTestCfg(es)
+	cfg.Dispatcher.Tracer = exporter
+	testEs := cfg.MakeExecServiceFromCfg()
+	testEs.Start()
+	defer testEs.Stop()
+
+	err, _ := testEs.Submit(NewBlockingTestTask(10, true))
+	assert.Nil(err)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if !assert.Len(lines, 2) {
+		return
+	}
+	var req OtlpTraceRequest
+	assert.Nil(json.Unmarshal(lines[1], &req))
+	rs := req.ResourceSpans[0]
+	assert.Equal([]OtlpKeyValue{{Key: "service.name", Value: OtlpAnyValue{StringValue: "orders"}}},
+		rs.Resource.Attributes)
+	span := rs.ScopeSpans[0].Spans[0]
+	assert.Equal("task", span.Name)
+	assert.Len(span.TraceId, 32)
+	assert.Len(span.SpanId, 16)
+	assert.Empty(span.ParentSpanId)
+	assert.Equal(1, span.Status.Code)
+	assert.NotEmpty(span.StartTimeUnixNano)
+
+	var execute OtlpTraceRequest
+	assert.Nil(json.Unmarshal(lines[0], &execute))
+	assert.Equal(span.SpanId, execute.ResourceSpans[0].ScopeSpans[0].Spans[0].ParentSpanId)
+}
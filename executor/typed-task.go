@@ -0,0 +1,163 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// TypedTask is the generic counterpart of Task. Instead of producing a
+// Response with JSON string result, it returns a typed result along with
+// a real error. Response channel plumbing is taken care of by the adapter
+// which turns it into a regular Task; so typed tasks flow through the same
+// Dispatcher and ExecutorPool as any other task.
+type TypedTask[R any] interface {
+	GetId() int
+
+	IsBlocking() bool
+
+	Run(ctx context.Context) (R, error)
+}
+
+// Adapter which makes a TypedTask a Task. Typed result and error are held
+// in the adapter itself, the Response carries status, the JSON form of the
+// result and the error for consumers of the untyped API.
+type typedTaskAdapter[R any] struct {
+	tt     TypedTask[R]
+	rc     chan Response
+	result R
+	err    error
+}
+
+func (ta *typedTaskAdapter[R]) GetId() int {
+	return ta.tt.GetId()
+}
+
+func (ta *typedTaskAdapter[R]) IsBlocking() bool {
+	return ta.tt.IsBlocking()
+}
+
+func (ta *typedTaskAdapter[R]) SetRespChan(rc chan Response) {
+	ta.rc = rc
+}
+
+func (ta *typedTaskAdapter[R]) GetRespChan() chan Response {
+	return ta.rc
+}
+
+func (ta *typedTaskAdapter[R]) Execute() Response {
+	return ta.ExecuteContext(context.Background())
+}
+
+func (ta *typedTaskAdapter[R]) ExecuteContext(ctx context.Context) Response {
+	resp := NewResponse(ta.GetId())
+	ta.result, ta.err = ta.tt.Run(ctx)
+	if ta.err != nil {
+		resp.Status = TaskStatusCompletedFailed
+		resp.Errors = append(resp.Errors, ta.err)
+	} else {
+		resp.Status = TaskStatusCompletedSuccessfully
+		// keep the untyped contract of the response as well
+		if ba, err := json.Marshal(ta.result); err == nil {
+			resp.Result = string(ba)
+		}
+	}
+	return *resp
+}
+
+// TypedFuture is the handle to the typed result of a TypedTask. Besides the
+// typed Get methods, it offers everything the Future offers.
+type TypedFuture[R any] struct {
+	*Future
+	adapter *typedTaskAdapter[R]
+}
+
+// Blocks until the task is done and returns its result. Error is the one
+// returned by the task, context.Canceled if the task was cancelled or an
+// error describing why the task could not complete.
+func (tf *TypedFuture[R]) Get() (R, error) {
+	return tf.typedResult(tf.Future.Get())
+}
+
+// Same as Get but waits at the most for the given duration, after which
+// context.DeadlineExceeded is returned.
+func (tf *TypedFuture[R]) GetWithTimeout(d time.Duration) (R, error) {
+	err, resp := tf.Future.GetWithTimeout(d)
+	if err != nil {
+		return *new(R), err
+	}
+	return tf.typedResult(resp)
+}
+
+func (tf *TypedFuture[R]) typedResult(resp *Response) (R, error) {
+	switch resp.Status {
+	case TaskStatusCompletedSuccessfully:
+		return tf.adapter.result, nil
+	case TaskStatusCancelled:
+		return *new(R), context.Canceled
+	default:
+		if len(resp.Errors) > 0 {
+			return *new(R), errors.Join(resp.Errors...)
+		}
+		return *new(R), errors.New("task did not complete successfully")
+	}
+}
+
+// Submit the typed task for execution and return the typed future to collect
+// its result.
+func SubmitTyped[R any](ctx context.Context, es *ExecutionService, tt TypedTask[R]) (error, *TypedFuture[R]) {
+	if tt == nil {
+		return ErrInvalidTask, nil
+	}
+	adapter := &typedTaskAdapter[R]{tt: tt}
+	err, f := es.SubmitAsync(ctx, adapter)
+	if err != nil {
+		return err, nil
+	}
+	return nil, &TypedFuture[R]{Future: f, adapter: adapter}
+}
+
+// Submit a plain function for async execution.
+func SubmitFunc[R any](es *ExecutionService, fn func(ctx context.Context) (R, error)) (error, *TypedFuture[R]) {
+	return SubmitFuncContext(context.Background(), es, fn)
+}
+
+// Submit a plain function for async execution; the context governs the
+// submission and is handed over to the function when it runs.
+func SubmitFuncContext[R any](ctx context.Context, es *ExecutionService,
+	fn func(ctx context.Context) (R, error)) (error, *TypedFuture[R]) {
+	if fn == nil {
+		return errors.New("invalid function"), nil
+	}
+	return SubmitTyped[R](ctx, es, &funcTask[R]{id: nextFuncTaskId(), fn: fn})
+}
+
+// Functions do not come with an id, so we assign ids counting down from -1
+// to stay clear of ids chosen by clients for their own tasks.
+var funcTaskIdCounter int64
+
+func nextFuncTaskId() int {
+	return int(atomic.AddInt64(&funcTaskIdCounter, -1))
+}
+
+type funcTask[R any] struct {
+	id int
+	fn func(ctx context.Context) (R, error)
+}
+
+func (ft *funcTask[R]) GetId() int {
+	return ft.id
+}
+
+func (ft *funcTask[R]) IsBlocking() bool {
+	return false
+}
+
+func (ft *funcTask[R]) Run(ctx context.Context) (R, error) {
+	return ft.fn(ctx)
+}
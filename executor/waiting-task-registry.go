@@ -0,0 +1,95 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"github.com/umeshgeeta/goshared/util"
+	"sync"
+	"sync/atomic"
+)
+
+// Number of shards, a power of 2.
+const registryShardCount = 16
+
+// Tasks submitted through the dispatcher waiting for their responses, keyed
+// by task id. Submitting go routines add entries, channel listeners look them
+// up and responding go routines remove them; all concurrently. So entries
+// are spread over shards, each with its own lock, to keep the contention low.
+//
+// An entry is removed before the response is handed over so that the task id
+// is free again by then, yet the task is counted till it is settled.
+type waitingTaskRegistry struct {
+	shards  [registryShardCount]registryShard
+	size    int64           // tasks added and not settled yet
+	settles *util.Condition // broadcast whenever a task is settled
+}
+
+type registryShard struct {
+	mux   sync.Mutex
+	tasks map[int]*waitingTask
+}
+
+func newWaitingTaskRegistry() *waitingTaskRegistry {
+	reg := new(waitingTaskRegistry)
+	for i := range reg.shards {
+		reg.shards[i].tasks = make(map[int]*waitingTask)
+	}
+	reg.settles = util.NewCondition()
+	return reg
+}
+
+func (reg *waitingTaskRegistry) shard(taskId int) *registryShard {
+	// task ids can be negative
+	return &reg.shards[uint(taskId)&(registryShardCount-1)]
+}
+
+// Add the waiting task unless another task with the same id is already
+// waiting, in which case false is returned.
+func (reg *waitingTaskRegistry) add(taskId int, wt *waitingTask) bool {
+	s := reg.shard(taskId)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, present := s.tasks[taskId]; present {
+		return false
+	}
+	s.tasks[taskId] = wt
+	atomic.AddInt64(&reg.size, 1)
+	return true
+}
+
+// Waiting task for the given task id, nil if there is none.
+func (reg *waitingTaskRegistry) get(taskId int) *waitingTask {
+	s := reg.shard(taskId)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.tasks[taskId]
+}
+
+// Remove the entry provided it is still the given waiting task. The task
+// is still counted till it is settled.
+func (reg *waitingTaskRegistry) remove(taskId int, wt *waitingTask) {
+	s := reg.shard(taskId)
+	s.mux.Lock()
+	if s.tasks[taskId] == wt {
+		delete(s.tasks, taskId)
+	}
+	s.mux.Unlock()
+}
+
+// A removed task is settled, its response is handed over.
+func (reg *waitingTaskRegistry) settled() {
+	atomic.AddInt64(&reg.size, -1)
+	reg.settles.Broadcast()
+}
+
+func (reg *waitingTaskRegistry) len() int {
+	return int(atomic.LoadInt64(&reg.size))
+}
+
+// Wait until no task is waiting for its response.
+func (reg *waitingTaskRegistry) awaitEmpty() {
+	reg.settles.WaitUntil(func() bool {
+		return reg.len() == 0
+	})
+}
@@ -0,0 +1,111 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package executor
+
+import (
+	"sync"
+)
+
+// Executors of the same kind - async or blocking - in an ExecutorPool with
+// work stealing turned on. A task is pinned to an executor when submitted,
+// but an executor which runs out of work of its own takes the next task from
+// the sibling with the longest queue. Since the victim is busy executing a
+// task, its next in line task is the one which benefits most from moving.
+type executorGroup struct {
+	mux      sync.Mutex
+	members  []*thread
+	blocking bool
+	changed  chan struct{} // closed and replaced when any member queue changes
+	stolen   func(blocking bool)
+}
+
+func newExecutorGroup(blocking bool, stolen func(blocking bool)) *executorGroup {
+	g := new(executorGroup)
+	g.blocking = blocking
+	g.changed = make(chan struct{})
+	g.stolen = stolen
+	return g
+}
+
+func (g *executorGroup) join(t *thread) {
+	g.mux.Lock()
+	g.members = append(g.members, t)
+	g.mux.Unlock()
+	t.group = g
+	t.taskQueue.listener = g.notify
+}
+
+func (g *executorGroup) leave(t *thread) {
+	g.mux.Lock()
+	for i, m := range g.members {
+		if m == t {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			break
+		}
+	}
+	g.mux.Unlock()
+	g.notify()
+}
+
+// Wake up idle members, a task was added to one of the queues or a queue was
+// closed.
+func (g *executorGroup) notify() {
+	g.mux.Lock()
+	close(g.changed)
+	g.changed = make(chan struct{})
+	g.mux.Unlock()
+}
+
+func (g *executorGroup) changes() chan struct{} {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.changed
+}
+
+// Take a task queued on the busiest sibling of the given member, if any.
+func (g *executorGroup) steal(thief *thread) (Task, bool) {
+	g.mux.Lock()
+	var victim *thread
+	most := 0
+	for _, m := range g.members {
+		if m == thief {
+			continue
+		}
+		if n := m.taskQueue.len(); n > most {
+			most = n
+			victim = m
+		}
+	}
+	g.mux.Unlock()
+	if victim == nil {
+		return nil, false
+	}
+	tsk, ok, _ := victim.taskQueue.poll()
+	if ok && g.stolen != nil {
+		g.stolen(g.blocking)
+	}
+	return tsk, ok
+}
+
+// Next task for the member; its own first, else a stolen one, else wait
+// until anything changes in the group. Returns false when the member's own
+// queue is closed.
+func (g *executorGroup) next(t *thread) (Task, bool) {
+	for {
+		// take the snapshot before looking at queues so that a change after
+		// we looked is not missed
+		ch := g.changes()
+		tsk, ok, closed := t.taskQueue.poll()
+		if closed {
+			return nil, false
+		}
+		if ok {
+			return tsk, true
+		}
+		if tsk, ok = g.steal(t); ok {
+			return tsk, true
+		}
+		<-ch
+	}
+}
@@ -35,74 +35,69 @@
 //
 // CondVar bundles required locker with it so as you do not need to do explicit
 // Lock and Unlock invocation around Wait.
+//
+// CondVar is now backed by Condition which never loses a wake up, so there
+// is no repeated broadcasting any more. Broadcast with r receipts hands out
+// r permits; a Wait consumes one, waiting for it if none is available. So a
+// waiter arriving after the Broadcast still gets through. New code should
+// use Condition directly.
 package util
 
 import (
 	"errors"
-	"fmt"
 	"sync"
-	"time"
 )
 
-// Wrapper around the built-in Cond struct. All additional variables are
-// for internal consumption only.
+// Wrapper around Condition. All additional variables are for internal
+// consumption only.
 type CondVar struct {
 	sync.Mutex
-	cond          *sync.Cond
-	gapInterval   int // in microseconds
-	durationLimit int // in microseconds
+	cond          *Condition
+	gapInterval   int // in microseconds, retained for compatibility
+	durationLimit int // in microseconds, retained for compatibility
 	howManyLeft   int
 }
 
 // Create CondVar where the first argument is the gap between two subsequent
 // broadcasts in microseconds. The second argument indicates how long to keep
-// broadcasting, duration again in microseconds.
+// broadcasting, duration again in microseconds. Since broadcasts are no longer
+// lost, both are retained only for compatibility and have no effect.
 func NewCondVar(gi int, dl int) *CondVar {
-	//defer LogDebug("NewCondVar constructed")
 	cv := new(CondVar)
-	cv.cond = sync.NewCond(cv)
+	cv.cond = NewCondition()
 	cv.gapInterval = gi
 	cv.durationLimit = dl
 	return cv
 }
 
-// Wait for a condition
+// Wait for a condition, that is for a permit handed out by Broadcast.
 func (cv *CondVar) Wait() {
-	cv.Lock()
-	cv.cond.Wait()
-	cv.howManyLeft--
-	//LogDebug(fmt.Sprintf("howManyLeft: %d", cv.howManyLeft))
-	cv.Unlock()
+	cv.cond.WaitUntil(func() bool {
+		if cv.howManyLeft > 0 {
+			cv.howManyLeft--
+			return true
+		}
+		return false
+	})
 }
 
 const errMsgBdincomplete = "earlier broadcast not complete"
 
-// Broadcast with how many 'receipts' from waiters are expected.
+// Broadcast with how many 'receipts' from waiters are expected. It fails if
+// receipts of an earlier broadcast are still pending.
 func (cv *CondVar) Broadcast(r int) error {
-	if cv.howManyLeft > 0 {
-		return errors.New(errMsgBdincomplete)
-	}
-	cv.Lock()
-	cv.howManyLeft = r
-	cv.Unlock()
-	go func() {
-		broadcast(cv)
-	}()
-	return nil
+	var err error
+	cv.cond.Update(func() {
+		if cv.howManyLeft > 0 {
+			err = errors.New(errMsgBdincomplete)
+			return
+		}
+		cv.howManyLeft = r
+	})
+	return err
 }
 
 // If any first listener responds saying it got the signal, we are ok here.
 func (cv *CondVar) Signal() error {
 	return cv.Broadcast(1)
 }
-
-func broadcast(cv *CondVar) {
-	start := time.Now().Nanosecond()
-	for cv.howManyLeft > 0 && (time.Now().Nanosecond() < start+(cv.durationLimit*1000)) {
-		cv.cond.Broadcast()
-		time.Sleep(time.Duration(cv.gapInterval) * time.Microsecond)
-	}
-	if cv.howManyLeft > 0 {
-		Log(fmt.Sprintf("Could not get receipt from all broadcast listeners. Left out: %d", cv.howManyLeft))
-	}
-}
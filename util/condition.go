@@ -0,0 +1,116 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Condition is a notification primitive which never loses a wake up. Instead
+// of parking go routines the way sync.Cond does, every waiter holds on to a
+// channel which is closed and replaced on each Broadcast. A waiter which
+// takes hold of the channel before checking its condition is guaranteed to
+// be woken up by any Broadcast made after the check; so WaitUntil, which does
+// exactly that, can never miss a change of the condition. Since waiting is
+// on a channel, it can also be abandoned with a context or a timeout.
+//
+// The usage pattern is, whoever changes the state the condition depends on
+// calls Broadcast after the change, or makes the change within Update.
+type Condition struct {
+	mux     sync.Mutex
+	changed chan struct{}
+}
+
+func NewCondition() *Condition {
+	c := new(Condition)
+	c.changed = make(chan struct{})
+	return c
+}
+
+// Wake up all go routines waiting at present.
+func (c *Condition) Broadcast() {
+	c.mux.Lock()
+	c.broadcastLocked()
+	c.mux.Unlock()
+}
+
+// caller holds the lock
+func (c *Condition) broadcastLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Make the change with the condition lock held, so that no predicate is
+// evaluated halfway through it, and then wake up all waiters.
+func (c *Condition) Update(change func()) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	change()
+	c.broadcastLocked()
+}
+
+// Channel closed on the next Broadcast; to be used in a select along with
+// other channels. Take it before checking the condition.
+func (c *Condition) Changed() <-chan struct{} {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.changed
+}
+
+// Wait for the next Broadcast.
+func (c *Condition) Wait() {
+	<-c.Changed()
+}
+
+// Wait for the next Broadcast or until the context is done, in which case
+// the context error is returned.
+func (c *Condition) WaitContext(ctx context.Context) error {
+	select {
+	case <-c.Changed():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait at the most for the given duration for the next Broadcast. Returns
+// false if the time is up without one.
+func (c *Condition) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.Changed():
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Wait until the predicate is true. Predicate is evaluated with the condition
+// lock held, first right away and then after every Broadcast; so it can also
+// claim whatever it found available without anyone else sneaking in.
+func (c *Condition) WaitUntil(predicate func() bool) {
+	c.WaitUntilContext(context.Background(), predicate)
+}
+
+// Same as WaitUntil, but gives up when the context is done in which case the
+// context error is returned.
+func (c *Condition) WaitUntilContext(ctx context.Context, predicate func() bool) error {
+	for {
+		c.mux.Lock()
+		if predicate() {
+			c.mux.Unlock()
+			return nil
+		}
+		ch := c.changed
+		c.mux.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCondition_WaitUntil(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCondition()
+	count := 0
+	const n = 1000
+
+	// many quick changes, not a single one of them may be missed
+	var done sync.WaitGroup
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			c.Update(func() {
+				count++
+			})
+		}()
+	}
+	c.WaitUntil(func() bool {
+		return count == n
+	})
+	done.Wait()
+	assert.Equal(n, count)
+
+	// predicate can claim what it waits for
+	permits := 0
+	var claimed sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		claimed.Add(1)
+		go func() {
+			defer claimed.Done()
+			c.WaitUntil(func() bool {
+				if permits > 0 {
+					permits--
+					return true
+				}
+				return false
+			})
+		}()
+	}
+	c.Update(func() {
+		permits = 3
+	})
+	claimed.Wait()
+	assert.Equal(0, permits)
+}
+
+func TestCondition_WaitContextAndTimeout(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCondition()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(c.WaitContext(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(c.WaitUntilContext(ctx, func() bool { return false }), context.DeadlineExceeded)
+	assert.Nil(c.WaitUntilContext(ctx, func() bool { return true }))
+	assert.False(c.WaitTimeout(time.Millisecond))
+
+	// keep broadcasting so that it does not matter who comes first
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.Broadcast()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}
+	}()
+	assert.True(c.WaitTimeout(time.Second))
+	close(stop)
+}
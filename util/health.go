@@ -0,0 +1,286 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type HealthStatus int
+
+const (
+	HealthUp HealthStatus = iota
+	HealthDegraded
+	HealthDown
+)
+
+func (hs HealthStatus) String() string {
+	switch hs {
+	case HealthUp:
+		return "UP"
+	case HealthDegraded:
+		return "DEGRADED"
+	case HealthDown:
+		return "DOWN"
+	}
+	return "HealthStatus(" + strconv.Itoa(int(hs)) + ")"
+}
+
+// Serialized by its name.
+func (hs HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(hs.String()), nil
+}
+
+func (hs *HealthStatus) UnmarshalText(text []byte) error {
+	for _, s := range []HealthStatus{HealthUp, HealthDegraded, HealthDown} {
+		if s.String() == string(text) {
+			*hs = s
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown health status %q", text)
+}
+
+// Worse of the two statuses.
+func (hs HealthStatus) Worst(other HealthStatus) HealthStatus {
+	if other > hs {
+		return other
+	}
+	return hs
+}
+
+// Health of an entity at a point of time. Details explain the status in
+// words, Metrics are the numbers threshold rules are evaluated against.
+type HealthReport struct {
+	Status  HealthStatus       `json:"status"`
+	Details map[string]string  `json:"details,omitempty"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Monitored entity which can tell whether it is healthy. Like GetData,
+// CheckHealth is invoked at every poll and so should be lightweight.
+type HealthChecker interface {
+	Monitored
+	CheckHealth() HealthReport
+}
+
+// Alerts when a metric stays above the threshold for the given duration.
+// To avoid flapping the alert is resolved only once the metric drops to the
+// threshold less the hysteresis or below. With Rate set the rule applies to
+// the per second rate at which the metric, a counter, increases between
+// evaluations, say rejections per second from the rejected tasks total.
+type ThresholdRule struct {
+	Name       string
+	Metric     string
+	Threshold  float64
+	For        time.Duration // zero fires at the first breach
+	Hysteresis float64
+	Rate       bool
+
+	// Status of the entity while the alert is firing, DEGRADED when unset.
+	Severity HealthStatus
+}
+
+var (
+	ErrUnnamedRule   = errors.New("threshold rule has no name or no metric")
+	ErrDuplicateRule = errors.New("threshold rule with the same name already exists")
+)
+
+type AlertState int
+
+const (
+	AlertFiring AlertState = iota
+	AlertResolved
+)
+
+func (as AlertState) String() string {
+	if as == AlertFiring {
+		return "FIRING"
+	}
+	return "RESOLVED"
+}
+
+// Raised when a rule starts firing and again when it is resolved.
+type Alert struct {
+	Rule     string
+	Entity   string
+	State    AlertState
+	Severity HealthStatus
+	Value    float64   // of the metric, or of its rate, at this evaluation
+	Since    time.Time // when the breach began
+	At       time.Time
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("%s alert %s on %s, value %g since %s", a.State, a.Rule, a.Entity, a.Value,
+		a.Since.Format(time.RFC3339))
+}
+
+type AlertHandler func(alert Alert)
+
+// Evaluates threshold rules against successive health reports and notifies
+// handlers of alerts. Alerts are de-duplicated: handlers hear once when a rule
+// starts firing and once when it is resolved, however many evaluations it
+// keeps firing in between. Safe for concurrent use.
+type HealthRules struct {
+	mux      sync.Mutex
+	rules    []*ruleState
+	handlers []AlertHandler
+}
+
+type ruleState struct {
+	ThresholdRule
+	breachedSince time.Time // zero when within the threshold
+	firing        bool
+	lastValue     float64 // of the metric at the previous evaluation, for rates
+	lastAt        time.Time
+	value         float64 // latest evaluated
+}
+
+func NewHealthRules(rules ...ThresholdRule) (*HealthRules, error) {
+	hr := new(HealthRules)
+	for _, r := range rules {
+		if err := hr.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return hr, nil
+}
+
+func (hr *HealthRules) Add(rule ThresholdRule) error {
+	if rule.Name == "" || rule.Metric == "" {
+		return ErrUnnamedRule
+	}
+	if rule.Severity == HealthUp {
+		rule.Severity = HealthDegraded
+	}
+	hr.mux.Lock()
+	defer hr.mux.Unlock()
+	for _, rs := range hr.rules {
+		if rs.Name == rule.Name {
+			return ErrDuplicateRule
+		}
+	}
+	hr.rules = append(hr.rules, &ruleState{ThresholdRule: rule})
+	return nil
+}
+
+// Handlers are invoked synchronously, in the order added, from the go routine
+// evaluating the rules.
+func (hr *HealthRules) OnAlert(handler AlertHandler) {
+	hr.mux.Lock()
+	hr.handlers = append(hr.handlers, handler)
+	hr.mux.Unlock()
+}
+
+// Evaluate the rules against the report of the entity taken at the given time.
+// The report returned has the status worsened to the severity of each firing
+// rule and a detail per firing rule. Rules whose metric is absent from the
+// report are left as they are.
+func (hr *HealthRules) Evaluate(entity string, report HealthReport, at time.Time) HealthReport {
+	var alerts []Alert
+	var handlers []AlertHandler
+	result := HealthReport{Status: report.Status, Metrics: report.Metrics, Details: make(map[string]string, len(report.Details))}
+	for k, v := range report.Details {
+		result.Details[k] = v
+	}
+
+	hr.mux.Lock()
+	for _, rs := range hr.rules {
+		if alert, changed := rs.evaluate(entity, report.Metrics, at); changed {
+			alerts = append(alerts, alert)
+		}
+		if rs.firing {
+			result.Status = result.Status.Worst(rs.Severity)
+			result.Details["rule."+rs.Name] = fmt.Sprintf("%s is %g, above %g since %s", rs.Metric, rs.value,
+				rs.Threshold, rs.breachedSince.Format(time.RFC3339))
+		}
+	}
+	if len(alerts) > 0 {
+		handlers = append(handlers, hr.handlers...)
+	}
+	hr.mux.Unlock()
+
+	for _, alert := range alerts {
+		for _, h := range handlers {
+			h(alert)
+		}
+	}
+	return result
+}
+
+// Alerts of the rules firing at present.
+func (hr *HealthRules) Firing(entity string) []Alert {
+	hr.mux.Lock()
+	defer hr.mux.Unlock()
+	var result []Alert
+	for _, rs := range hr.rules {
+		if rs.firing {
+			result = append(result, rs.alert(entity, AlertFiring, time.Now()))
+		}
+	}
+	return result
+}
+
+// Caller holds the lock. Returns the alert when the rule starts firing or is
+// resolved.
+func (rs *ruleState) evaluate(entity string, metrics map[string]float64, at time.Time) (Alert, bool) {
+	value, found := metrics[rs.Metric]
+	if !found {
+		return Alert{}, false
+	}
+	if rs.Rate {
+		prev, prevAt := rs.lastValue, rs.lastAt
+		rs.lastValue, rs.lastAt = value, at
+		elapsed := at.Sub(prevAt).Seconds()
+		if prevAt.IsZero() || elapsed <= 0 {
+			return Alert{}, false
+		}
+		value = (value - prev) / elapsed
+	}
+	rs.value = value
+
+	if rs.firing {
+		if value <= rs.Threshold-rs.Hysteresis {
+			rs.firing = false
+			alert := rs.alert(entity, AlertResolved, at)
+			rs.breachedSince = time.Time{}
+			return alert, true
+		}
+		return Alert{}, false
+	}
+	if value <= rs.Threshold {
+		rs.breachedSince = time.Time{}
+		return Alert{}, false
+	}
+	if rs.breachedSince.IsZero() {
+		rs.breachedSince = at
+	}
+	if at.Sub(rs.breachedSince) >= rs.For {
+		rs.firing = true
+		return rs.alert(entity, AlertFiring, at), true
+	}
+	return Alert{}, false
+}
+
+func (rs *ruleState) alert(entity string, state AlertState, at time.Time) Alert {
+	return Alert{
+		Rule:     rs.Name,
+		Entity:   entity,
+		State:    state,
+		Severity: rs.Severity,
+		Value:    rs.value,
+		Since:    rs.breachedSince,
+		At:       at,
+	}
+}
+
+// Logs every alert.
+func LogAlert(alert Alert) {
+	Log(alert.String())
+}
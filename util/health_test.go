@@ -0,0 +1,155 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func depth(value float64) HealthReport {
+	return HealthReport{Status: HealthUp, Metrics: map[string]float64{"depth": value}}
+}
+
+func TestHealthRules_ForAndHysteresis(t *testing.T) {
+	assert := assert.New(t)
+	hr, err := NewHealthRules(ThresholdRule{Name: "deep", Metric: "depth", Threshold: 10, For: 3 * time.Second, Hysteresis: 4})
+	assert.Nil(err)
+	var alerts []Alert
+	hr.OnAlert(func(alert Alert) {
+		alerts = append(alerts, alert)
+	})
+	start := time.Now()
+	at := func(sec int) time.Time {
+		return start.Add(time.Duration(sec) * time.Second)
+	}
+
+	// a short breach does not fire
+	assert.Equal(HealthUp, hr.Evaluate("e", depth(20), at(0)).Status)
+	assert.Equal(HealthUp, hr.Evaluate("e", depth(5), at(1)).Status)
+	assert.Empty(alerts)
+
+	hr.Evaluate("e", depth(11), at(2))
+	hr.Evaluate("e", depth(12), at(4))
+	report := hr.Evaluate("e", depth(13), at(5))
+	assert.Equal(HealthDegraded, report.Status)
+	assert.Contains(report.Details, "rule.deep")
+	assert.Len(alerts, 1)
+	assert.Equal(AlertFiring, alerts[0].State)
+	assert.Equal(13.0, alerts[0].Value)
+	assert.Equal(at(2), alerts[0].Since)
+	assert.Len(hr.Firing("e"), 1)
+
+	// neither repeated while firing nor resolved within the hysteresis band
+	hr.Evaluate("e", depth(30), at(6))
+	assert.Equal(HealthDegraded, hr.Evaluate("e", depth(8), at(7)).Status)
+	assert.Len(alerts, 1)
+	// a missing metric changes nothing
+	assert.Equal(HealthDegraded, hr.Evaluate("e", HealthReport{}, at(8)).Status)
+
+	assert.Equal(HealthUp, hr.Evaluate("e", depth(6), at(9)).Status)
+	assert.Len(alerts, 2)
+	assert.Equal(AlertResolved, alerts[1].State)
+	assert.Empty(hr.Firing("e"))
+}
+
+func TestHealthRules_Rate(t *testing.T) {
+	assert := assert.New(t)
+	hr, _ := NewHealthRules(ThresholdRule{Name: "rejections", Metric: "rejected", Threshold: 2, Rate: true, Severity: HealthDown})
+	start := time.Now()
+	rejected := func(total float64, sec int) HealthReport {
+		return hr.Evaluate("e", HealthReport{Metrics: map[string]float64{"rejected": total}}, start.Add(time.Duration(sec)*time.Second))
+	}
+	assert.Equal(HealthUp, rejected(100, 0).Status)
+	assert.Equal(HealthUp, rejected(104, 2).Status)
+	assert.Equal(HealthDown, rejected(110, 4).Status)
+	assert.Equal(HealthUp, rejected(110, 5).Status)
+}
+
+func TestHealthRules_Invalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewHealthRules(ThresholdRule{Metric: "m"})
+	assert.Equal(ErrUnnamedRule, err)
+	_, err = NewHealthRules(ThresholdRule{Name: "a", Metric: "m"}, ThresholdRule{Name: "a", Metric: "n"})
+	assert.Equal(ErrDuplicateRule, err)
+}
+
+func TestHealthStatus_Json(t *testing.T) {
+	assert := assert.New(t)
+	ba, err := json.Marshal(HealthReport{Status: HealthDegraded})
+	assert.Nil(err)
+	assert.Equal(`{"status":"DEGRADED"}`, string(ba))
+	var report HealthReport
+	assert.Nil(json.Unmarshal([]byte(`{"status":"DOWN"}`), &report))
+	assert.Equal(HealthDown, report.Status)
+}
+
+type checkedEntity struct {
+	countingEntity
+	mux   sync.Mutex
+	depth float64
+}
+
+func (ce *checkedEntity) CheckHealth() HealthReport {
+	ce.mux.Lock()
+	defer ce.mux.Unlock()
+	return depth(ce.depth)
+}
+
+func TestMonitor_HealthRules(t *testing.T) {
+	assert := assert.New(t)
+	ce := &checkedEntity{countingEntity: countingEntity{name: "checked"}, depth: 50}
+	// zero frequency polls as often as allowed
+	m, _ := NewMonitor(0, 1, ce)
+	hr, _ := NewHealthRules(ThresholdRule{Name: "deep", Metric: "depth", Threshold: 10})
+	var mux sync.Mutex
+	var alerts []Alert
+	hr.OnAlert(func(alert Alert) {
+		mux.Lock()
+		alerts = append(alerts, alert)
+		mux.Unlock()
+	})
+	m.SetHealthRules(hr)
+	_, checked := m.Health()
+	assert.False(checked)
+
+	m.Start()
+	defer m.Stop()
+	// nobody reads the channel, yet health is checked and Stop is not held up
+	assert.Eventually(func() bool {
+		report, checked := m.Health()
+		return checked && report.Status == HealthDegraded
+	}, time.Second, time.Millisecond)
+	assert.Len(m.Alerts(), 1)
+	assert.Equal("checked", m.Alerts()[0].Entity)
+
+	// polling goes on past the channel buffer, so the alert is resolved
+	assert.Eventually(func() bool {
+		return atomic.LoadInt64(&ce.polls) > 2
+	}, time.Second, time.Millisecond)
+	ce.mux.Lock()
+	ce.depth = 5
+	ce.mux.Unlock()
+	assert.Eventually(func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(alerts) == 2
+	}, time.Second, time.Millisecond)
+	mux.Lock()
+	if assert.Len(alerts, 2) {
+		assert.Equal(AlertFiring, alerts[0].State)
+		assert.Equal(AlertResolved, alerts[1].State)
+	}
+	mux.Unlock()
+	assert.Eventually(func() bool {
+		report, _ := m.Health()
+		return report.Status == HealthUp
+	}, time.Second, time.Millisecond)
+	assert.Empty(m.Alerts())
+	assert.Len(m.MonDataChan, 1)
+}
@@ -130,7 +130,7 @@ func SetDebugLog(val bool) {
 // Log the given message.
 func Log(msg string) {
 	log.Println(msg)
-	if GlobalLogSettings.LogOnConsole {
+	if GlobalLogSettings != nil && GlobalLogSettings.LogOnConsole {
 		fmt.Println(msg)
 	}
 }
@@ -138,7 +138,7 @@ func Log(msg string) {
 // Log debug messages. Invocation of this call will result in adding the message
 // to the log provided SetDebugLog(true) is called.
 func LogDebug(msg string) {
-	if GlobalLogSettings.DebugLog {
+	if GlobalLogSettings != nil && GlobalLogSettings.DebugLog {
 		Log(msg)
 	}
 }
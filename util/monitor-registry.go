@@ -0,0 +1,194 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Shortest interval at which an entity is polled; anything shorter, including
+// zero, is raised to it.
+const MinMonitorInterval = 10 * time.Millisecond
+
+var (
+	ErrNilMonitored         = errors.New("entity to be monitored is nil")
+	ErrDuplicateMonitorName = errors.New("entity with the same name is already monitored")
+)
+
+// One GetData result of a monitored entity, what sinks receive.
+type Sample struct {
+	Name string    // of the entity
+	Time time.Time // when the Data was obtained
+	Blob Blob
+}
+
+// Destination of samples of monitored entities. Publish is invoked from the
+// polling go routines of all entities, so it must be safe for concurrent use
+// and should not block for long as the entity is not polled meanwhile. Sinks
+// which also implement io.Closer are closed when the registry is stopped.
+type MonitorSink interface {
+	Publish(s Sample) error
+}
+
+// Adapter to use an ordinary function as a MonitorSink.
+type MonitorSinkFunc func(s Sample) error
+
+func (f MonitorSinkFunc) Publish(s Sample) error {
+	return f(s)
+}
+
+// Polls any number of entities, each at its own interval, and hands every
+// sample to all sinks. Entities and sinks can be added before or after Start.
+// A failing sink is logged and does not affect other sinks.
+type MonitorRegistry struct {
+	mux      sync.Mutex
+	entities map[string]*monitoredEntry
+	sinks    []MonitorSink
+	quit     chan struct{} // closed to stop, nil when not running
+	running  sync.WaitGroup
+}
+
+type monitoredEntry struct {
+	entity   Monitored
+	interval time.Duration
+	remove   chan struct{} // closed when unregistered
+}
+
+func NewMonitorRegistry(sinks ...MonitorSink) *MonitorRegistry {
+	mr := new(MonitorRegistry)
+	mr.entities = make(map[string]*monitoredEntry)
+	mr.sinks = append(mr.sinks, sinks...)
+	return mr
+}
+
+// Poll the entity at the given interval, which can be less than a second.
+// The entity is identified by its name which has to be unique in the registry.
+func (mr *MonitorRegistry) Register(entity Monitored, interval time.Duration) error {
+	if entity == nil {
+		return ErrNilMonitored
+	}
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+	name := entity.Name()
+	if _, found := mr.entities[name]; found {
+		return ErrDuplicateMonitorName
+	}
+	entry := &monitoredEntry{entity: entity, interval: pollInterval(interval), remove: make(chan struct{})}
+	mr.entities[name] = entry
+	if mr.quit != nil {
+		mr.poll(entry, mr.quit)
+	}
+	return nil
+}
+
+// Stop polling the entity with the given name; false if there is none.
+func (mr *MonitorRegistry) Unregister(name string) bool {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+	entry, found := mr.entities[name]
+	if found {
+		close(entry.remove)
+		delete(mr.entities, name)
+	}
+	return found
+}
+
+func (mr *MonitorRegistry) AddSink(sink MonitorSink) {
+	mr.mux.Lock()
+	mr.sinks = append(mr.sinks, sink)
+	mr.mux.Unlock()
+}
+
+// Names of entities being monitored, in no particular order.
+func (mr *MonitorRegistry) Names() []string {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+	result := make([]string, 0, len(mr.entities))
+	for name := range mr.entities {
+		result = append(result, name)
+	}
+	return result
+}
+
+// Start polling all entities registered; no op if already started.
+func (mr *MonitorRegistry) Start() {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+	if mr.quit != nil {
+		return
+	}
+	mr.quit = make(chan struct{})
+	for _, entry := range mr.entities {
+		mr.poll(entry, mr.quit)
+	}
+}
+
+// Stop polling and close sinks which are io.Closer. It returns once polling
+// go routines are done, which is right away unless a sink is busy publishing;
+// none is waiting for its next turn to notice. The registry can be started
+// again, but closed sinks are not reopened.
+func (mr *MonitorRegistry) Stop() {
+	mr.mux.Lock()
+	if mr.quit == nil {
+		mr.mux.Unlock()
+		return
+	}
+	close(mr.quit)
+	mr.quit = nil
+	mr.mux.Unlock()
+	mr.running.Wait()
+
+	for _, sink := range mr.sinksInUse() {
+		if c, ok := sink.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				Log(fmt.Sprintf("Failed to close monitor sink: %v", err))
+			}
+		}
+	}
+}
+
+// Caller holds the lock.
+func (mr *MonitorRegistry) poll(entry *monitoredEntry, quit chan struct{}) {
+	mr.running.Add(1)
+	go func() {
+		defer mr.running.Done()
+		ticker := time.NewTicker(entry.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-entry.remove:
+				return
+			case <-ticker.C:
+			}
+			mr.publish(Sample{Name: entry.entity.Name(), Time: time.Now(), Blob: entry.entity.GetData()})
+		}
+	}()
+}
+
+func (mr *MonitorRegistry) publish(s Sample) {
+	for _, sink := range mr.sinksInUse() {
+		if err := sink.Publish(s); err != nil {
+			Log(fmt.Sprintf("Failed to publish monitoring data of %s: %v", s.Name, err))
+		}
+	}
+}
+
+func (mr *MonitorRegistry) sinksInUse() []MonitorSink {
+	mr.mux.Lock()
+	defer mr.mux.Unlock()
+	return append([]MonitorSink(nil), mr.sinks...)
+}
+
+func pollInterval(d time.Duration) time.Duration {
+	if d < MinMonitorInterval {
+		return MinMonitorInterval
+	}
+	return d
+}
@@ -0,0 +1,199 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingEntity struct {
+	name  string
+	polls int64
+}
+
+func (ce *countingEntity) GetData() Blob {
+	n := atomic.AddInt64(&ce.polls, 1)
+	return Blob{Data: []byte(`{"poll":` + strconv.FormatInt(n, 10) + `}`)}
+}
+
+func (ce *countingEntity) Name() string {
+	return ce.name
+}
+
+func TestMonitorRegistry_SubSecondPolling(t *testing.T) {
+	assert := assert.New(t)
+	rb := NewRingBufferSink(100)
+	mr := NewMonitorRegistry(rb)
+	fast := &countingEntity{name: "fast"}
+	slow := &countingEntity{name: "slow"}
+	assert.Nil(mr.Register(fast, 20*time.Millisecond))
+	assert.Nil(mr.Register(slow, 200*time.Millisecond))
+	assert.Equal(ErrDuplicateMonitorName, mr.Register(&countingEntity{name: "fast"}, time.Second))
+	assert.Equal(ErrNilMonitored, mr.Register(nil, time.Second))
+
+	mr.Start()
+	time.Sleep(300 * time.Millisecond)
+	mr.Stop()
+
+	polled := atomic.LoadInt64(&fast.polls)
+	assert.GreaterOrEqual(polled, int64(5))
+	assert.GreaterOrEqual(atomic.LoadInt64(&slow.polls), int64(1))
+	assert.Less(atomic.LoadInt64(&slow.polls), polled)
+
+	latest, found := rb.Latest("fast")
+	assert.True(found)
+	assert.Equal(`{"poll":`+strconv.FormatInt(polled, 10)+`}`, string(latest.Blob.Data))
+
+	// nothing is polled once stopped
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(polled, atomic.LoadInt64(&fast.polls))
+}
+
+func TestMonitorRegistry_StopIsImmediate(t *testing.T) {
+	assert := assert.New(t)
+	mr := NewMonitorRegistry(LogSink{})
+	assert.Nil(mr.Register(&countingEntity{name: "hourly"}, time.Hour))
+	mr.Start()
+	start := time.Now()
+	mr.Stop()
+	assert.Less(time.Since(start), 100*time.Millisecond)
+	mr.Stop()
+}
+
+func TestMonitorRegistry_Unregister(t *testing.T) {
+	assert := assert.New(t)
+	mr := NewMonitorRegistry()
+	ce := &countingEntity{name: "gone"}
+	assert.Nil(mr.Register(ce, 10*time.Millisecond))
+	mr.Start()
+	defer mr.Stop()
+	assert.True(mr.Unregister("gone"))
+	assert.False(mr.Unregister("gone"))
+	assert.Empty(mr.Names())
+	polled := atomic.LoadInt64(&ce.polls)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(polled, atomic.LoadInt64(&ce.polls))
+}
+
+func TestChannelSink_DropsOldest(t *testing.T) {
+	assert := assert.New(t)
+	cs := NewChannelSink(2)
+	for i := 1; i <= 5; i++ {
+		assert.Nil(cs.Publish(Sample{Name: strconv.Itoa(i)}))
+	}
+	assert.Equal(int64(3), cs.Dropped())
+	assert.Equal("4", (<-cs.C()).Name)
+	assert.Equal("5", (<-cs.C()).Name)
+}
+
+func TestRingBufferSink_Wraps(t *testing.T) {
+	assert := assert.New(t)
+	rb := NewRingBufferSink(3)
+	assert.Empty(rb.Samples())
+	for i := 1; i <= 4; i++ {
+		rb.Publish(Sample{Name: strconv.Itoa(i)})
+	}
+	var names []string
+	for _, s := range rb.Samples() {
+		names = append(names, s.Name)
+	}
+	assert.Equal([]string{"2", "3", "4"}, names)
+	_, found := rb.Latest("1")
+	assert.False(found)
+}
+
+func TestJsonLinesSink(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	js := NewJsonLinesSink(&buf)
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(js.Publish(Sample{Name: "a", Time: at, Blob: Blob{Data: []byte(`{"x":1}`)}}))
+	assert.Nil(js.Publish(Sample{Name: "b", Time: at, Blob: Blob{Data: []byte("not json")}}))
+	assert.Equal(`{"name":"a","time":"2020-01-02T03:04:05Z","data":{"x":1}}`+"\n"+
+		`{"name":"b","time":"2020-01-02T03:04:05Z","data":"not json"}`+"\n", buf.String())
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (cr *closeRecorder) Close() error {
+	cr.closed = true
+	return nil
+}
+
+func TestJsonLinesSink_Close(t *testing.T) {
+	assert := assert.New(t)
+	// a writer of the caller is left open when the registry stops
+	cr := new(closeRecorder)
+	mr := NewMonitorRegistry(NewJsonLinesSink(cr))
+	mr.Start()
+	mr.Stop()
+	assert.False(cr.closed)
+
+	// the file of a file sink is closed
+	fileName := filepath.Join(t.TempDir(), "samples.jsonl")
+	fs, err := NewJsonLinesFileSink(fileName)
+	assert.Nil(err)
+	assert.Nil(fs.Publish(Sample{Name: "a", Blob: Blob{Data: []byte("1")}}))
+	assert.Nil(fs.Close())
+	assert.Nil(fs.Close())
+	assert.NotNil(fs.Publish(Sample{Name: "b"}))
+	ba, err := os.ReadFile(fileName)
+	assert.Nil(err)
+	assert.Equal(1, strings.Count(string(ba), "\n"))
+}
+
+func TestHttpSink(t *testing.T) {
+	assert := assert.New(t)
+	var mux sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ba, _ := io.ReadAll(r.Body)
+		mux.Lock()
+		received = append(received, r.Header.Get("Content-Type")+" "+string(ba))
+		mux.Unlock()
+		if strings.Contains(string(ba), "bad") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	hs := NewHttpSink(server.URL, nil)
+	assert.Nil(hs.Publish(Sample{Name: "good", Blob: Blob{Data: []byte(`{"ok":true}`)}}))
+	assert.NotNil(hs.Publish(Sample{Name: "bad"}))
+	mux.Lock()
+	defer mux.Unlock()
+	assert.Len(received, 2)
+	assert.True(strings.HasPrefix(received[0], "application/json "))
+	var sj sampleJson
+	assert.Nil(json.Unmarshal([]byte(strings.TrimPrefix(received[0], "application/json ")), &sj))
+	assert.Equal("good", sj.Name)
+	assert.Equal(`{"ok":true}`, string(sj.Data))
+}
+
+func TestMonitor_StopIsImmediate(t *testing.T) {
+	assert := assert.New(t)
+	m, err := NewMonitor(3600, 1, &countingEntity{name: "legacy"})
+	assert.Nil(err)
+	m.Start()
+	m.Stop()
+	m.Stop()
+	_, err = NewMonitor(1, 1, nil)
+	assert.Equal(ErrNilMonitored, err)
+}
@@ -0,0 +1,222 @@
+// MIT License
+// Author: Umesh Patil, Neosemantix, Inc.
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// How a sample is written by the JSON sinks. Data is embedded as is when it
+// is valid Json, as it typically is, otherwise as a string.
+type sampleJson struct {
+	Name string          `json:"name"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (s Sample) MarshalJSON() ([]byte, error) {
+	data := json.RawMessage(s.Blob.Data)
+	if !json.Valid(data) {
+		ba, err := json.Marshal(string(s.Blob.Data))
+		if err != nil {
+			return nil, err
+		}
+		data = ba
+	}
+	return json.Marshal(sampleJson{Name: s.Name, Time: s.Time, Data: data})
+}
+
+// Logs every sample as util.Monitor does.
+type LogSink struct{}
+
+func (LogSink) Publish(s Sample) error {
+	Log(s.Name + ":  " + string(s.Blob.Data))
+	return nil
+}
+
+// Hands samples over through a buffered channel. Publishing never blocks,
+// when the buffer is full the oldest sample is dropped to make room for the
+// new one; so a slow or absent reader does not hold up monitoring and sees
+// the latest data when it catches up.
+type ChannelSink struct {
+	mux     sync.Mutex
+	c       chan Sample
+	dropped int64
+}
+
+// The buffer holds at least one sample.
+func NewChannelSink(bufSz int) *ChannelSink {
+	if bufSz < 1 {
+		bufSz = 1
+	}
+	return &ChannelSink{c: make(chan Sample, bufSz)}
+}
+
+func (cs *ChannelSink) C() <-chan Sample {
+	return cs.c
+}
+
+// Number of samples dropped so far.
+func (cs *ChannelSink) Dropped() int64 {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	return cs.dropped
+}
+
+func (cs *ChannelSink) Publish(s Sample) error {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	for {
+		select {
+		case cs.c <- s:
+			return nil
+		default:
+		}
+		// the reader may have emptied the buffer in between
+		select {
+		case <-cs.c:
+			cs.dropped++
+		default:
+		}
+	}
+}
+
+// Writes every sample as one line of Json.
+type JsonLinesSink struct {
+	mux   sync.Mutex
+	w     io.Writer
+	owned io.Closer // file opened by the sink, nil if the writer is the caller's
+}
+
+// The writer stays the caller's to close.
+func NewJsonLinesSink(w io.Writer) *JsonLinesSink {
+	return &JsonLinesSink{w: w}
+}
+
+// Appends to the file, creating it if needed. The file is closed when the
+// registry is stopped.
+func NewJsonLinesFileSink(fileName string) (*JsonLinesSink, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonLinesSink{w: f, owned: f}, nil
+}
+
+func (js *JsonLinesSink) Publish(s Sample) error {
+	ba, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	js.mux.Lock()
+	defer js.mux.Unlock()
+	_, err = js.w.Write(append(ba, '\n'))
+	return err
+}
+
+// Closes the file of a file sink, only once; a writer given by the caller is
+// left alone.
+func (js *JsonLinesSink) Close() error {
+	js.mux.Lock()
+	defer js.mux.Unlock()
+	if js.owned == nil {
+		return nil
+	}
+	err := js.owned.Close()
+	js.owned = nil
+	return err
+}
+
+// Default timeout of requests made by HttpSink.
+const DefaultHttpSinkTimeout = 5 * time.Second
+
+// Posts every sample as Json to the URL; any status other than 2xx is an
+// error.
+type HttpSink struct {
+	url    string
+	client *http.Client
+}
+
+// Client is optional, when nil a client with DefaultHttpSinkTimeout is used.
+func NewHttpSink(url string, client *http.Client) *HttpSink {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultHttpSinkTimeout}
+	}
+	return &HttpSink{url: url, client: client}
+}
+
+func (hs *HttpSink) Publish(s Sample) error {
+	ba, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	resp, err := hs.client.Post(hs.url, "application/json", bytes.NewReader(ba))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("monitoring data post to %s failed: %s", hs.url, resp.Status)
+	}
+	return nil
+}
+
+// Keeps the latest samples in memory, the oldest are overwritten once the
+// capacity is reached.
+type RingBufferSink struct {
+	mux     sync.Mutex
+	samples []Sample
+	next    int // where the next sample goes
+	full    bool
+}
+
+// The buffer holds at least one sample.
+func NewRingBufferSink(capacity int) *RingBufferSink {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingBufferSink{samples: make([]Sample, capacity)}
+}
+
+func (rb *RingBufferSink) Publish(s Sample) error {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	rb.samples[rb.next] = s
+	rb.next = (rb.next + 1) % len(rb.samples)
+	if rb.next == 0 {
+		rb.full = true
+	}
+	return nil
+}
+
+// Samples held, oldest first.
+func (rb *RingBufferSink) Samples() []Sample {
+	rb.mux.Lock()
+	defer rb.mux.Unlock()
+	if !rb.full {
+		return append([]Sample(nil), rb.samples[:rb.next]...)
+	}
+	result := make([]Sample, 0, len(rb.samples))
+	result = append(result, rb.samples[rb.next:]...)
+	return append(result, rb.samples[:rb.next]...)
+}
+
+// Latest sample of the entity with the given name, false if there is none.
+func (rb *RingBufferSink) Latest(name string) (Sample, bool) {
+	samples := rb.Samples()
+	for i := len(samples) - 1; i >= 0; i-- {
+		if samples[i].Name == name {
+			return samples[i], true
+		}
+	}
+	return Sample{}, false
+}
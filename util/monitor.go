@@ -4,7 +4,7 @@
 package util
 
 import (
-	"errors"
+	"sync"
 	"time"
 )
 
@@ -28,21 +28,30 @@ type Blob struct {
 }
 
 // Monitors the specified entity by invoking it's GetData at given frequency.
-// For now it only Logs the Data.
+// For now it only Logs the Data. When the entity is a HealthChecker its
+// health is checked as well and threshold rules, if set, are evaluated.
+// MonitorRegistry is the one to use for many entities, sub-second frequencies
+// or other destinations of the Data.
 type Monitor struct {
-	continueRun bool
-	frequency   int // in seconds
+	mux         sync.Mutex
+	quit        chan struct{} // closed to stop, nil when not running
+	frequency   int           // in seconds
 	monEntity   *Monitored
 	MonDataChan chan Blob // exposed so anyone interested in Data can get handle
+	rules       *HealthRules
+	health      *HealthReport // latest, nil till the first check
 }
 
 // Builds a new monitor for the given entity. GetData method on that entity will
 // be invoked at the given frequency. Error is thrown when the entity is nil.
 // There is no validation on the frequency number right now, it is Seconds.
+// The channel buffer holds at least one Blob.
 func NewMonitor(freq int, chanBufSz int, entity Monitored) (*Monitor, error) {
 	if entity == nil {
-		err := errors.New("entity to be monitored is nil")
-		return nil, err
+		return nil, ErrNilMonitored
+	}
+	if chanBufSz < 1 {
+		chanBufSz = 1
 	}
 	m := &Monitor{}
 	m.frequency = freq
@@ -58,20 +67,103 @@ func NewBlob(ba []byte) *Blob {
 }
 
 func (m *Monitor) Start() {
-	m.continueRun = true
-	go m.monitor()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.quit != nil {
+		return
+	}
+	m.quit = make(chan struct{})
+	go m.monitor(m.quit)
 }
 
+// Stops the monitor right away, even if it is sleeping.
 func (m *Monitor) Stop() {
-	m.continueRun = false
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.quit != nil {
+		close(m.quit)
+		m.quit = nil
+	}
 }
 
-func (m *Monitor) monitor() {
-	for m.continueRun {
-		time.Sleep(time.Duration(m.frequency) * time.Second)
+func (m *Monitor) monitor(quit chan struct{}) {
+	defer Log("Monitor for entity " + (*m.monEntity).Name() + " stopped.")
+	ticker := time.NewTicker(pollInterval(time.Duration(m.frequency) * time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
 		blob := (*m.monEntity).GetData()
-		m.MonDataChan <- blob
+		m.checkHealth()
+		m.publish(blob)
 		Log((*m.monEntity).Name() + ":  " + string(blob.Data))
 	}
-	Log("Monitor for entity " + (*m.monEntity).Name() + " stopped.")
+}
+
+// Never blocks, so polling and health checks go on when nobody reads
+// MonDataChan; when the buffer is full the oldest Data is dropped as
+// ChannelSink does.
+func (m *Monitor) publish(blob Blob) {
+	for {
+		select {
+		case m.MonDataChan <- blob:
+			return
+		default:
+		}
+		// the reader may have emptied the buffer in between
+		select {
+		case <-m.MonDataChan:
+		default:
+		}
+	}
+}
+
+// Threshold rules to evaluate at every poll, nil for none. Rules are evaluated
+// only when the entity is a HealthChecker.
+func (m *Monitor) SetHealthRules(rules *HealthRules) {
+	m.mux.Lock()
+	m.rules = rules
+	m.mux.Unlock()
+}
+
+// Latest health of the entity with firing rules taken into account; false
+// when the entity is not a HealthChecker or it is not polled yet.
+func (m *Monitor) Health() (HealthReport, bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.health == nil {
+		return HealthReport{}, false
+	}
+	return *m.health, true
+}
+
+// Alerts of the rules firing at present.
+func (m *Monitor) Alerts() []Alert {
+	m.mux.Lock()
+	rules := m.rules
+	m.mux.Unlock()
+	if rules == nil {
+		return nil
+	}
+	return rules.Firing((*m.monEntity).Name())
+}
+
+func (m *Monitor) checkHealth() {
+	hc, ok := (*m.monEntity).(HealthChecker)
+	if !ok {
+		return
+	}
+	report := hc.CheckHealth()
+	m.mux.Lock()
+	rules := m.rules
+	m.mux.Unlock()
+	if rules != nil {
+		report = rules.Evaluate(hc.Name(), report, time.Now())
+	}
+	m.mux.Lock()
+	m.health = &report
+	m.mux.Unlock()
 }